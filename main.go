@@ -2,34 +2,187 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"vwap/pkg"
+	"vwap/pkg/alerts"
+	"vwap/pkg/coinbase/auth"
 	"vwap/pkg/coinbase/calculator"
 	"vwap/pkg/coinbase/handler"
+	"vwap/pkg/dtos"
+	"vwap/pkg/metrics"
+	"vwap/pkg/std/notifier"
 	"vwap/pkg/std/websocket"
 )
 
 const (
 	avgDataDelay = 0.0
+	// snapshotPath keeps the sliding windows across restarts, kindly change it as desired.
+	snapshotPath     = "vwap_snapshot.json"
+	snapshotInterval = time.Minute
+	// alertsPath holds the alerting rules, alerting is disabled when the file does not exist.
+	alertsPath = "alerts.json"
+	// feedURL is the Coinbase feed, kindly change it to handler.SandboxURL or a local mock as desired.
+	feedURL     = handler.ProductionURL
+	dialTimeout = 10 * time.Second
+	// pingInterval keeps the connection alive, it's dropped and restored when nothing, pongs
+	// included, arrives within readTimeout or a write exceeds writeTimeout.
+	pingInterval = 10 * time.Second
+	readTimeout  = 30 * time.Second
+	writeTimeout = 10 * time.Second
+	// credentialsPath holds the API key, the feed is not authenticated when neither it nor the
+	// COINBASE_API_* variables exist.
+	credentialsPath = "credentials.json"
+	// httpAddr serves the Prometheus metrics at /metrics and the /healthz and /readyz probes.
+	httpAddr = ":9090"
+	// livenessTimeout is how long the feed may stay silent before /healthz fails.
+	livenessTimeout = 30 * time.Second
+	// warmWindow lets illiquid products count as ready without a trade once it has elapsed.
+	warmWindow = time.Minute
+	// productsPerConnection spreads the products across as many connections as needed.
+	productsPerConnection = 10
 )
 
 func main() {
-	websocket := websocket.NewStdWebsocket()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	newWebsocket := func() pkg.Websocket { return websocket.NewStdWebsocket() }
+	websocket := newWebsocket()
 	// The Delay time for sending the calculated average. Kindly change it as desired.
-	vwapCalculator := calculator.NewCoinbaseCalculator(avgDataDelay)
-	handler := handler.NewCoinbaseHandler(websocket, vwapCalculator)
+	vwapCalculator, err := calculator.NewCoinbaseCalculator(avgDataDelay,
+		calculator.WithSnapshot(snapshotPath, snapshotInterval),
+		calculator.WithBands(1, 2, 3),
+		calculator.WithCandles(time.Minute),
+		calculator.WithTriangles(),
+		calculator.WithOwnFills(),
+		calculator.WithDefaultProductConfig(calculator.ProductConfig{
+			Windows: []calculator.Window{
+				{Trades: 200},
+				{Trades: 50},
+				{Trades: 1000},
+				{Duration: 5 * time.Minute},
+			},
+			Filter: calculator.TradeFilter{
+				RejectInvalid: true,
+				MaxDeviation:  0.05,
+				MinTrades:     20,
+				// follows sustained moves instead of rejecting them forever
+				ReanchorAfter: 10,
+			},
+			Aggregators: []calculator.AggregatorFactory{
+				calculator.NewTWAPAggregator,
+				calculator.NewSMAAggregator,
+				calculator.NewMedianAggregator,
+			},
+		}),
+	)
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+	handlerOpts, err := authOptions()
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+	handler := handler.NewCoinbaseHandler(websocket, vwapCalculator, append(handlerOpts,
+		handler.WithURL(feedURL),
+		handler.WithDialTimeout(dialTimeout),
+		handler.WithPingInterval(pingInterval),
+		handler.WithReadTimeout(readTimeout),
+		handler.WithWriteTimeout(writeTimeout),
+		handler.WithLivenessTimeout(livenessTimeout),
+		handler.WithWarmWindow(warmWindow),
+		handler.WithTicker(),
+		handler.WithSharding(productsPerConnection, newWebsocket),
+	)...)
+	go serveHTTP(handler)
 
-	responseChan, err := handler.Subscribe(context.Background(), "BTC-USD", "ETH-USD", "ETH-BTC")
+	responseChan, err := handler.Subscribe(ctx, "BTC-USD", "ETH-USD", "ETH-BTC")
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+	responseChan, err = watchAlerts(ctx, responseChan)
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
 	for {
 		select {
-		case <-context.Background().Done():
+		case <-ctx.Done():
+			// waits for the calculator to write its last snapshot
+			vwapCalculator.Close()
 			return
 		case msg := <-responseChan:
 			fmt.Printf("Received: %v.\n", msg)
+		case candle := <-vwapCalculator.Candles():
+			fmt.Printf("Candle: %v.\n", candle)
+		case event := <-vwapCalculator.Events():
+			fmt.Printf("Event: %v.\n", event)
+		case event := <-handler.Events():
+			fmt.Printf("Event: %v.\n", event)
+		}
+	}
+}
+
+// authOptions authenticates the feed and subscribes to our own orders, when credentials are configured
+func authOptions() ([]handler.Option, error) {
+	credentials, err := auth.LoadCredentials(credentialsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []handler.Option{handler.WithCredentials(credentials), handler.WithUserChannel()}, nil
+}
+
+// watchAlerts evaluates the alerting rules against every emission, when configured
+func watchAlerts(ctx context.Context, responseChan <-chan *dtos.ProductAvgs) (<-chan *dtos.ProductAvgs, error) {
+	config, err := alerts.LoadConfig(alertsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return responseChan, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	alertNotifier, err := notifier.NewNotifier(config.Notifier.Type, config.Notifier.Target)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := alerts.NewEngine(alertNotifier, config.Rules...)
+	if err != nil {
+		return nil, err
+	}
+	return engine.Watch(ctx, responseChan), nil
+}
+
+// serveHTTP exposes the Prometheus metrics and the probes, failing to serve them does not stop the calculator
+func serveHTTP(feed *handler.CoinbaseHandler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", probe(feed.Healthy))
+	mux.HandleFunc("/readyz", probe(feed.Ready))
+	if err := http.ListenAndServe(httpAddr, mux); err != nil {
+		log.Printf("http server: %v", err)
+	}
+}
+
+// probe answers 200 when the check passes and 503 with the reason otherwise
+func probe(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
 		}
+		fmt.Fprintln(w, "ok")
 	}
 }
@@ -0,0 +1,103 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	// CrossRule triggers when the vwap crosses Level, in any direction
+	CrossRule = "cross"
+	// MoveRule triggers when the vwap moves more than Percent within Period
+	MoveRule = "move"
+	// DeviationRule triggers when the last price deviates more than Percent from the vwap
+	DeviationRule = "deviation"
+)
+
+// Config defines the alerting file, the notifier the alerts are delivered to and the rules
+type Config struct {
+	Notifier NotifierConfig `json:"notifier"`
+	Rules    []Rule         `json:"rules"`
+}
+
+// NotifierConfig selects the notifier, Target being the webhook url or the file path
+type NotifierConfig struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// Rule defines an alerting rule over the vwap of a product
+type Rule struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	ProductId string   `json:"product_id"`
+	Level     float64  `json:"level,omitempty"`
+	Percent   float64  `json:"percent,omitempty"`
+	Period    Duration `json:"period,omitempty"`
+}
+
+// Duration reads durations written as strings, e.g. "5m"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// validate checks the rule has every field its type requires
+func (r Rule) validate() error {
+	if r.ProductId == "" {
+		return fmt.Errorf("rule %q: no product id provided", r.Name)
+	}
+	switch r.Type {
+	case CrossRule:
+		if r.Level <= 0 {
+			return fmt.Errorf("rule %q: cross rules require a positive level", r.Name)
+		}
+	case MoveRule:
+		if r.Percent <= 0 || r.Period.Duration <= 0 {
+			return fmt.Errorf("rule %q: move rules require a positive percent and period", r.Name)
+		}
+	case DeviationRule:
+		if r.Percent <= 0 {
+			return fmt.Errorf("rule %q: deviation rules require a positive percent", r.Name)
+		}
+	default:
+		return fmt.Errorf("rule %q: unknown rule type %q", r.Name, r.Type)
+	}
+	return nil
+}
+
+// LoadConfig reads and validates the alerting configuration file
+func LoadConfig(path string) (*Config, error) {
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := json.Unmarshal(payload, config); err != nil {
+		return nil, err
+	}
+	for _, rule := range config.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
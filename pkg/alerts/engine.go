@@ -0,0 +1,96 @@
+package alerts
+
+import (
+	"context"
+	"log"
+	"time"
+	"vwap/pkg"
+	"vwap/pkg/dtos"
+)
+
+// alertsBuffer is how many alerts wait for the notifier, later ones are logged instead
+const alertsBuffer = 64
+
+// Engine evaluates the alerting rules against every emission of the calculator
+type Engine struct {
+	rules      []Rule
+	evaluators []evaluator
+	notifier   pkg.Notifier
+	// alerts queues the triggered alerts so a slow notifier never holds the emissions back
+	alerts chan *dtos.Alert
+	now    func() time.Time
+}
+
+// evaluate runs every rule of the products present in the emission, queueing the triggered alerts
+func (e *Engine) evaluate(productAvgs *dtos.ProductAvgs) {
+	now := e.now()
+	for i, rule := range e.rules {
+		vwap := productAvgs.Products[rule.ProductId].Float()
+		if vwap == nil {
+			continue
+		}
+		message, value := e.evaluators[i].evaluate(now, vwap, productAvgs.LastPrices[rule.ProductId].Float())
+		if message == "" {
+			continue
+		}
+		select {
+		case e.alerts <- alert(rule, now, message, value):
+		default:
+			log.Printf("alerts queue full, dropping alert %q: %s", rule.Name, message)
+		}
+	}
+}
+
+// notify delivers the queued alerts until the context is done
+func (e *Engine) notify(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-e.alerts:
+			if err := e.notifier.Notify(ctx, alert); err != nil {
+				log.Printf("unable to notify alert %q: %v", alert.Rule, err)
+			}
+		}
+	}
+}
+
+// Watch evaluates the rules against every emission and forwards it on the returned channel,
+// alerts are notified in the background
+func (e *Engine) Watch(ctx context.Context, productAvgsChan <-chan *dtos.ProductAvgs) <-chan *dtos.ProductAvgs {
+	forward := make(chan *dtos.ProductAvgs)
+	go e.notify(ctx)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case productAvgs := <-productAvgsChan:
+				e.evaluate(productAvgs)
+				select {
+				case forward <- productAvgs:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return forward
+}
+
+// NewEngine creates the rules engine, rules are validated since they can be built by hand
+func NewEngine(notifier pkg.Notifier, rules ...Rule) (*Engine, error) {
+	e := &Engine{
+		rules:    rules,
+		notifier: notifier,
+		alerts:   make(chan *dtos.Alert, alertsBuffer),
+		now:      time.Now,
+	}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		e.evaluators = append(e.evaluators, newEvaluator(rule))
+	}
+	return e, nil
+}
@@ -0,0 +1,192 @@
+package alerts
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"vwap/pkg/dtos"
+	"vwap/pkg/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestEngine_Watch(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		// vwaps and lastPrices are emitted one minute apart
+		vwaps      []float64
+		lastPrices []float64
+		alerts     int
+	}{
+		{
+			name:   "test vwap crosses level",
+			rule:   Rule{Name: "btc 60k", Type: CrossRule, ProductId: "BTC-USD", Level: 60000},
+			vwaps:  []float64{59000, 59500, 60500, 60600, 59900},
+			alerts: 2,
+		},
+		{
+			name:   "test vwap never crosses level",
+			rule:   Rule{Name: "btc 60k", Type: CrossRule, ProductId: "BTC-USD", Level: 60000},
+			vwaps:  []float64{59000, 59500, 59900},
+			alerts: 0,
+		},
+		{
+			name:   "test vwap moves within period",
+			rule:   Rule{Name: "btc 1%", Type: MoveRule, ProductId: "BTC-USD", Percent: 1, Period: Duration{5 * time.Minute}},
+			vwaps:  []float64{100, 100.5, 101.5, 101.6, 101.7},
+			alerts: 1,
+		},
+		{
+			name:   "test vwap moves slower than period",
+			rule:   Rule{Name: "btc 1%", Type: MoveRule, ProductId: "BTC-USD", Percent: 1, Period: Duration{time.Minute}},
+			vwaps:  []float64{100, 100.6, 101.2, 101.8},
+			alerts: 0,
+		},
+		{
+			name:       "test last price deviates from vwap",
+			rule:       Rule{Name: "btc deviation", Type: DeviationRule, ProductId: "BTC-USD", Percent: 0.5},
+			vwaps:      []float64{100, 100, 100, 100},
+			lastPrices: []float64{100.1, 100.6, 100.7, 99.4},
+			alerts:     1,
+		},
+		{
+			name:   "test other products ignored",
+			rule:   Rule{Name: "eth 60k", Type: CrossRule, ProductId: "ETH-USD", Level: 60000},
+			vwaps:  []float64{59000, 61000},
+			alerts: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			rule := tt.rule
+			notified := make(chan *dtos.Alert, len(tt.vwaps))
+			notifier := &mocks.Notifier{}
+			notifier.On("Notify", ctx, mock.MatchedBy(func(alert *dtos.Alert) bool {
+				return alert.Rule == rule.Name && alert.ProductId == rule.ProductId
+			})).Run(func(args mock.Arguments) {
+				notified <- args.Get(1).(*dtos.Alert)
+			}).Return(nil)
+			e, err := NewEngine(notifier, rule)
+			assert.NoError(t, err)
+			now := time.Now()
+			e.now = func() time.Time { return now }
+
+			in := make(chan *dtos.ProductAvgs)
+			out := e.Watch(ctx, in)
+			for i, vwap := range tt.vwaps {
+				productAvgs := &dtos.ProductAvgs{
+					Products:   map[string]dtos.Decimal{"BTC-USD": dtos.NewDecimal(big.NewFloat(vwap))},
+					LastPrices: map[string]dtos.Decimal{},
+				}
+				if tt.lastPrices != nil {
+					productAvgs.LastPrices["BTC-USD"] = dtos.NewDecimal(big.NewFloat(tt.lastPrices[i]))
+				}
+				in <- productAvgs
+				assert.Equal(t, productAvgs, <-out)
+				now = now.Add(time.Minute)
+			}
+			// alerts are notified in the background
+			for i := 0; i < tt.alerts; i++ {
+				select {
+				case <-notified:
+				case <-time.After(time.Second):
+					assert.Fail(t, "alert not notified")
+				}
+			}
+			assert.Empty(t, notified)
+		})
+	}
+}
+
+func TestEngine_WatchSlowNotifier(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release := make(chan struct{})
+	notifier := &mocks.Notifier{}
+	notifier.On("Notify", ctx, mock.Anything).Run(func(args mock.Arguments) {
+		<-release
+	}).Return(nil)
+	rule := Rule{Name: "btc 60k", Type: CrossRule, ProductId: "BTC-USD", Level: 60000}
+	e, err := NewEngine(notifier, rule)
+	assert.NoError(t, err)
+
+	in := make(chan *dtos.ProductAvgs)
+	out := e.Watch(ctx, in)
+	// every emission crosses the level while the notifier hangs, the emissions keep flowing
+	// and the alerts exceeding the queue are dropped
+	for i := 0; i < 2*alertsBuffer+2; i++ {
+		vwap := 59000.0
+		if i%2 == 1 {
+			vwap = 61000.0
+		}
+		productAvgs := &dtos.ProductAvgs{
+			Products: map[string]dtos.Decimal{"BTC-USD": dtos.NewDecimal(big.NewFloat(vwap))},
+		}
+		in <- productAvgs
+		select {
+		case forwarded := <-out:
+			assert.Equal(t, productAvgs, forwarded)
+		case <-time.After(time.Second):
+			assert.FailNow(t, "emission not forwarded")
+		}
+	}
+	assert.Len(t, e.alerts, alertsBuffer)
+	close(release)
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{
+			name: "test load config success",
+			payload: `{
+				"notifier": {"type": "webhook", "target": "http://localhost:8080/alerts"},
+				"rules": [
+					{"name": "btc 60k", "type": "cross", "product_id": "BTC-USD", "level": 60000},
+					{"name": "eth 1%", "type": "move", "product_id": "ETH-USD", "percent": 1, "period": "5m"},
+					{"name": "btc deviation", "type": "deviation", "product_id": "BTC-USD", "percent": 0.5}
+				]
+			}`,
+		},
+		{
+			name:    "test unknown rule type",
+			payload: `{"rules": [{"name": "btc", "type": "unknown", "product_id": "BTC-USD"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "test move rule without period",
+			payload: `{"rules": [{"name": "btc", "type": "move", "product_id": "BTC-USD", "percent": 1}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "test invalid period",
+			payload: `{"rules": [{"name": "btc", "type": "move", "product_id": "BTC-USD", "percent": 1, "period": "5 minutes"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "alerts.json")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.payload), 0644))
+			config, err := LoadConfig(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "webhook", config.Notifier.Type)
+			assert.Len(t, config.Rules, 3)
+			assert.Equal(t, 5*time.Minute, config.Rules[1].Period.Duration)
+		})
+	}
+}
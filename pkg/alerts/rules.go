@@ -0,0 +1,119 @@
+package alerts
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+	"vwap/pkg/dtos"
+)
+
+// evaluator keeps the state of a rule between emissions, it returns the alert message when the rule triggers
+type evaluator interface {
+	evaluate(now time.Time, vwap, lastPrice *big.Float) (string, *big.Float)
+}
+
+func newEvaluator(rule Rule) evaluator {
+	switch rule.Type {
+	case CrossRule:
+		return &crossEvaluator{level: big.NewFloat(rule.Level)}
+	case MoveRule:
+		return &moveEvaluator{percent: rule.Percent, period: rule.Period.Duration}
+	default:
+		return &deviationEvaluator{percent: rule.Percent}
+	}
+}
+
+// crossEvaluator triggers every time the vwap ends up on the other side of the level
+type crossEvaluator struct {
+	level *big.Float
+	side  int
+}
+
+func (c *crossEvaluator) evaluate(now time.Time, vwap, lastPrice *big.Float) (string, *big.Float) {
+	side := vwap.Cmp(c.level)
+	previous := c.side
+	if side != 0 {
+		c.side = side
+	}
+	if previous == 0 || side == 0 || side == previous {
+		return "", nil
+	}
+	direction := "above"
+	if side < 0 {
+		direction = "below"
+	}
+	return fmt.Sprintf("vwap crossed %s %s", direction, c.level.Text('f', -1)), vwap
+}
+
+type vwapSample struct {
+	time time.Time
+	vwap *big.Float
+}
+
+// moveEvaluator triggers when the vwap changed more than percent over the period,
+// once per move: it has to get back within the limit before triggering again
+type moveEvaluator struct {
+	percent   float64
+	period    time.Duration
+	samples   []vwapSample
+	triggered bool
+}
+
+func (m *moveEvaluator) evaluate(now time.Time, vwap, lastPrice *big.Float) (string, *big.Float) {
+	m.samples = append(m.samples, vwapSample{time: now, vwap: vwap})
+	// keeps the last sample taken at or before the period start as the base
+	for len(m.samples) > 1 && !m.samples[1].time.After(now.Add(-m.period)) {
+		m.samples = m.samples[1:]
+	}
+	change := percentChange(m.samples[0].vwap, vwap)
+	exceeded := change > m.percent || change < -m.percent
+	if !exceeded || m.triggered {
+		m.triggered = exceeded
+		return "", nil
+	}
+	m.triggered = true
+	return fmt.Sprintf("vwap moved %.4f%% in %s", change, m.period), vwap
+}
+
+// deviationEvaluator triggers when the last price deviates more than percent from the vwap,
+// once per deviation: it has to get back within the limit before triggering again
+type deviationEvaluator struct {
+	percent   float64
+	triggered bool
+}
+
+func (d *deviationEvaluator) evaluate(now time.Time, vwap, lastPrice *big.Float) (string, *big.Float) {
+	if lastPrice == nil {
+		return "", nil
+	}
+	deviation := percentChange(vwap, lastPrice)
+	exceeded := deviation > d.percent || deviation < -d.percent
+	if !exceeded || d.triggered {
+		d.triggered = exceeded
+		return "", nil
+	}
+	d.triggered = true
+	return fmt.Sprintf("last price %s deviates %.4f%% from vwap", lastPrice.Text('f', -1), deviation), lastPrice
+}
+
+// percentChange returns the change from base to value in percent
+func percentChange(base, value *big.Float) float64 {
+	if base.Sign() == 0 {
+		return 0
+	}
+	change := new(big.Float).Sub(value, base)
+	change.Quo(change, base)
+	percent, _ := change.Float64()
+	return percent * 100
+}
+
+// alert builds the alert raised by the rule
+func alert(rule Rule, now time.Time, message string, value *big.Float) *dtos.Alert {
+	return &dtos.Alert{
+		Rule:      rule.Name,
+		ProductId: rule.ProductId,
+		Time:      now,
+		Message:   message,
+		Value:     dtos.NewDecimal(value),
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+	"vwap/pkg/dtos"
+)
+
+const (
+	// KeyEnv, SecretEnv and PassphraseEnv hold the credentials, they take precedence over the file
+	KeyEnv        = "COINBASE_API_KEY"
+	SecretEnv     = "COINBASE_API_SECRET"
+	PassphraseEnv = "COINBASE_API_PASSPHRASE"
+	// verifyPath is the request the websocket feed expects to be signed
+	verifyPath = "GET/users/self/verify"
+)
+
+// Credentials defines a Coinbase API key, Secret being the base64 encoded secret
+type Credentials struct {
+	Key        string `json:"key"`
+	Secret     string `json:"secret"`
+	Passphrase string `json:"passphrase"`
+}
+
+// LoadCredentials reads the credentials from the environment, falling back to the json file at path.
+// It returns an error wrapping os.ErrNotExist when there are no credentials at all.
+func LoadCredentials(path string) (Credentials, error) {
+	credentials := Credentials{
+		Key:        os.Getenv(KeyEnv),
+		Secret:     os.Getenv(SecretEnv),
+		Passphrase: os.Getenv(PassphraseEnv),
+	}
+	if credentials == (Credentials{}) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Credentials{}, err
+		}
+		if err := json.Unmarshal(data, &credentials); err != nil {
+			return Credentials{}, fmt.Errorf("invalid credentials file %s: %w", path, err)
+		}
+	}
+	if err := credentials.validate(); err != nil {
+		return Credentials{}, err
+	}
+	return credentials, nil
+}
+
+func (c Credentials) validate() error {
+	if c.Key == "" || c.Secret == "" || c.Passphrase == "" {
+		return errors.New("credentials need a key, a secret and a passphrase")
+	}
+	if _, err := base64.StdEncoding.DecodeString(c.Secret); err != nil {
+		return fmt.Errorf("credentials secret is not base64: %w", err)
+	}
+	return nil
+}
+
+// Sign authenticates the subscription with a signature of the current time, it's meant to be set as the
+// Sign function of the subscription so it's signed again on every reconnection
+func (c Credentials) Sign(subscription *dtos.Subscription) error {
+	return c.sign(subscription, time.Now())
+}
+
+func (c Credentials) sign(subscription *dtos.Subscription, now time.Time) error {
+	signature, timestamp, err := c.signature(now)
+	if err != nil {
+		return err
+	}
+	subscription.Signature = signature
+	subscription.Key = c.Key
+	subscription.Passphrase = c.Passphrase
+	subscription.Timestamp = timestamp
+	return nil
+}
+
+// signature returns the base64 HMAC-SHA256 of the timestamp and the verify request, keyed by the secret
+func (c Credentials) signature(now time.Time) (string, string, error) {
+	secret, err := base64.StdEncoding.DecodeString(c.Secret)
+	if err != nil {
+		return "", "", fmt.Errorf("credentials secret is not base64: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + verifyPath))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), timestamp, nil
+}
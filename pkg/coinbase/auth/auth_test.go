@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentials_Sign(t *testing.T) {
+	credentials := Credentials{
+		Key:        "key",
+		Secret:     "dGVzdC1zZWNyZXQ=",
+		Passphrase: "passphrase",
+	}
+	subscription := &dtos.Subscription{Type: "subscribe"}
+	assert.NoError(t, credentials.sign(subscription, time.Unix(1609459200, 0)))
+	assert.Equal(t, &dtos.Subscription{
+		Type:       "subscribe",
+		Signature:  "ioNtUMfb14ewz+WlVaBkO2exoiHHrh1VVKmWIMqeQwU=",
+		Key:        "key",
+		Passphrase: "passphrase",
+		Timestamp:  "1609459200",
+	}, subscription)
+
+	credentials.Secret = "not base64"
+	assert.Error(t, credentials.Sign(subscription))
+}
+
+func TestLoadCredentials(t *testing.T) {
+	const (
+		fromEnv = iota
+		fromFile
+		missing
+		incomplete
+	)
+	tests := []struct {
+		name     string
+		testType int
+		want     Credentials
+		wantErr  bool
+	}{
+		{
+			name:     "test credentials from the environment",
+			testType: fromEnv,
+			want:     Credentials{Key: "env-key", Secret: "dGVzdC1zZWNyZXQ=", Passphrase: "env-passphrase"},
+		},
+		{
+			name:     "test credentials from the file",
+			testType: fromFile,
+			want:     Credentials{Key: "file-key", Secret: "dGVzdC1zZWNyZXQ=", Passphrase: "file-passphrase"},
+		},
+		{
+			name:     "test missing credentials",
+			testType: missing,
+			wantErr:  true,
+		},
+		{
+			name:     "test incomplete credentials",
+			testType: incomplete,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "credentials.json")
+			for _, env := range []string{KeyEnv, SecretEnv, PassphraseEnv} {
+				t.Setenv(env, "")
+			}
+			switch tt.testType {
+			case fromEnv:
+				t.Setenv(KeyEnv, "env-key")
+				t.Setenv(SecretEnv, "dGVzdC1zZWNyZXQ=")
+				t.Setenv(PassphraseEnv, "env-passphrase")
+			case fromFile:
+				data := `{"key":"file-key","secret":"dGVzdC1zZWNyZXQ=","passphrase":"file-passphrase"}`
+				assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+			case incomplete:
+				t.Setenv(KeyEnv, "env-key")
+			}
+			credentials, err := LoadCredentials(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, tt.testType == missing, errors.Is(err, os.ErrNotExist))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, credentials)
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package calculator
+
+import (
+	"math/big"
+	"sort"
+	"vwap/pkg/dtos"
+)
+
+// Aggregator computes a metric over the trades held by the sliding window of a product.
+// Add is called for every new trade and Evict for every trade leaving the window, so
+// implementations can keep their state incrementally instead of iterating the window.
+type Aggregator interface {
+	Name() string
+	Add(point *dtos.Match)
+	Evict(point *dtos.Match)
+	Value() *big.Float
+}
+
+// AggregatorFactory creates a new aggregator for every product
+type AggregatorFactory func() Aggregator
+
+// varianceAggregator is implemented by the vwap aggregators that also track the volume weighted variance
+type varianceAggregator interface {
+	Aggregator
+	Variance() *big.Float
+}
+
+// volumeWeightedVariance returns Σ(s·p²)/Σs − vwap², clamped at zero against rounding errors
+func volumeWeightedVariance(totalWeightedSquares, totalWeightedValues, totalWeights *big.Float) *big.Float {
+	if totalWeights.Sign() == 0 {
+		return new(big.Float)
+	}
+	vwap := new(big.Float).Quo(totalWeightedValues, totalWeights)
+	variance := new(big.Float).Quo(totalWeightedSquares, totalWeights)
+	variance.Sub(variance, vwap.Mul(vwap, vwap))
+	if variance.Sign() < 0 {
+		return new(big.Float)
+	}
+	return variance
+}
+
+// weightedSquare returns s·p² of the point
+func weightedSquare(point *dtos.Match) *big.Float {
+	square := new(big.Float).Mul(point.Price, point.Price)
+	return square.Mul(square, point.Size)
+}
+
+// vwapAggregator is the volume weighted average price of the window
+type vwapAggregator struct {
+	totalWeightedValues  *big.Float
+	totalWeights         *big.Float
+	totalWeightedSquares *big.Float
+}
+
+// NewVWAPAggregator creates the volume weighted average price aggregator
+func NewVWAPAggregator() Aggregator {
+	return newVWAPAggregator()
+}
+
+func newVWAPAggregator() *vwapAggregator {
+	return &vwapAggregator{
+		totalWeightedValues:  new(big.Float),
+		totalWeights:         new(big.Float),
+		totalWeightedSquares: new(big.Float),
+	}
+}
+
+func (v *vwapAggregator) Name() string {
+	return "vwap"
+}
+
+func (v *vwapAggregator) Add(point *dtos.Match) {
+	mul := new(big.Float).Mul(point.Price, point.Size)
+	v.totalWeightedValues.Add(v.totalWeightedValues, mul)
+	v.totalWeights.Add(v.totalWeights, point.Size)
+	v.totalWeightedSquares.Add(v.totalWeightedSquares, weightedSquare(point))
+}
+
+func (v *vwapAggregator) Evict(point *dtos.Match) {
+	mul := new(big.Float).Mul(point.Price, point.Size)
+	v.totalWeightedValues.Sub(v.totalWeightedValues, mul)
+	v.totalWeights.Sub(v.totalWeights, point.Size)
+	v.totalWeightedSquares.Sub(v.totalWeightedSquares, weightedSquare(point))
+}
+
+func (v *vwapAggregator) Value() *big.Float {
+	if v.totalWeights.Sign() == 0 {
+		return new(big.Float)
+	}
+	return new(big.Float).Quo(v.totalWeightedValues, v.totalWeights)
+}
+
+func (v *vwapAggregator) Variance() *big.Float {
+	return volumeWeightedVariance(v.totalWeightedSquares, v.totalWeightedValues, v.totalWeights)
+}
+
+// anchoredAggregator is the vwap accumulated since the session anchor, see AnchoredMode.
+// Trades never leave it, the whole aggregator is replaced when the session resets.
+type anchoredAggregator struct {
+	*vwapAggregator
+}
+
+func newAnchoredAggregator() *anchoredAggregator {
+	return &anchoredAggregator{
+		vwapAggregator: newVWAPAggregator(),
+	}
+}
+
+func (a *anchoredAggregator) Name() string {
+	return "anchored_vwap"
+}
+
+func (a *anchoredAggregator) Evict(point *dtos.Match) {}
+
+// twapInterval is the price held between a trade and the next one
+type twapInterval struct {
+	price    *big.Float
+	duration *big.Float
+}
+
+// twapAggregator is the time weighted average price of the window, every price
+// weighs the trade time it lasted until the next trade
+type twapAggregator struct {
+	last          *dtos.Match
+	intervals     []twapInterval
+	totalWeighted *big.Float
+	totalDuration *big.Float
+}
+
+// NewTWAPAggregator creates the time weighted average price aggregator
+func NewTWAPAggregator() Aggregator {
+	return &twapAggregator{
+		totalWeighted: new(big.Float),
+		totalDuration: new(big.Float),
+	}
+}
+
+func (t *twapAggregator) Name() string {
+	return "twap"
+}
+
+func (t *twapAggregator) Add(point *dtos.Match) {
+	if t.last != nil {
+		elapsed := point.Time.Sub(t.last.Time)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		interval := twapInterval{
+			price:    t.last.Price,
+			duration: big.NewFloat(elapsed.Seconds()),
+		}
+		t.intervals = append(t.intervals, interval)
+		t.totalWeighted.Add(t.totalWeighted, new(big.Float).Mul(interval.price, interval.duration))
+		t.totalDuration.Add(t.totalDuration, interval.duration)
+	}
+	t.last = point
+}
+
+// Evict drops the interval started by the evicted trade, which is always the oldest one
+func (t *twapAggregator) Evict(point *dtos.Match) {
+	if len(t.intervals) == 0 {
+		return
+	}
+	interval := t.intervals[0]
+	t.intervals = t.intervals[1:]
+	t.totalWeighted.Sub(t.totalWeighted, new(big.Float).Mul(interval.price, interval.duration))
+	t.totalDuration.Sub(t.totalDuration, interval.duration)
+}
+
+// Value falls back to the last price while the window spans no time at all
+func (t *twapAggregator) Value() *big.Float {
+	if t.totalDuration.Sign() == 0 {
+		if t.last == nil {
+			return new(big.Float)
+		}
+		return new(big.Float).Set(t.last.Price)
+	}
+	return new(big.Float).Quo(t.totalWeighted, t.totalDuration)
+}
+
+// smaAggregator is the simple moving average of the prices in the window
+type smaAggregator struct {
+	total *big.Float
+	count int64
+}
+
+// NewSMAAggregator creates the simple moving average of price aggregator
+func NewSMAAggregator() Aggregator {
+	return &smaAggregator{
+		total: new(big.Float),
+	}
+}
+
+func (s *smaAggregator) Name() string {
+	return "sma"
+}
+
+func (s *smaAggregator) Add(point *dtos.Match) {
+	s.total.Add(s.total, point.Price)
+	s.count++
+}
+
+func (s *smaAggregator) Evict(point *dtos.Match) {
+	s.total.Sub(s.total, point.Price)
+	s.count--
+}
+
+func (s *smaAggregator) Value() *big.Float {
+	if s.count == 0 {
+		return new(big.Float)
+	}
+	return new(big.Float).Quo(s.total, new(big.Float).SetInt64(s.count))
+}
+
+// medianAggregator is the median price of the window, prices are kept sorted
+type medianAggregator struct {
+	prices []*big.Float
+}
+
+// NewMedianAggregator creates the median price aggregator
+func NewMedianAggregator() Aggregator {
+	return &medianAggregator{}
+}
+
+func (m *medianAggregator) Name() string {
+	return "median"
+}
+
+// search returns the position of the first price not lower than price
+func (m *medianAggregator) search(price *big.Float) int {
+	return sort.Search(len(m.prices), func(i int) bool {
+		return m.prices[i].Cmp(price) >= 0
+	})
+}
+
+func (m *medianAggregator) Add(point *dtos.Match) {
+	i := m.search(point.Price)
+	m.prices = append(m.prices, nil)
+	copy(m.prices[i+1:], m.prices[i:])
+	m.prices[i] = point.Price
+}
+
+func (m *medianAggregator) Evict(point *dtos.Match) {
+	i := m.search(point.Price)
+	if i < len(m.prices) && m.prices[i].Cmp(point.Price) == 0 {
+		m.prices = append(m.prices[:i], m.prices[i+1:]...)
+	}
+}
+
+func (m *medianAggregator) Value() *big.Float {
+	n := len(m.prices)
+	if n == 0 {
+		return new(big.Float)
+	}
+	if n%2 == 1 {
+		return new(big.Float).Set(m.prices[n/2])
+	}
+	sum := new(big.Float).Add(m.prices[n/2-1], m.prices[n/2])
+	return sum.Quo(sum, big.NewFloat(2))
+}
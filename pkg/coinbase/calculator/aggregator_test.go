@@ -0,0 +1,119 @@
+package calculator
+
+import (
+	"math/big"
+	"testing"
+	"time"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregators(t *testing.T) {
+	start := time.Now()
+	points := []*dtos.Match{
+		{Time: start, Price: big.NewFloat(10.0), Size: big.NewFloat(1.0)},
+		{Time: start.Add(time.Second), Price: big.NewFloat(20.0), Size: big.NewFloat(3.0)},
+		{Time: start.Add(4 * time.Second), Price: big.NewFloat(40.0), Size: big.NewFloat(1.0)},
+		{Time: start.Add(5 * time.Second), Price: big.NewFloat(30.0), Size: big.NewFloat(1.0)},
+	}
+	tests := []struct {
+		name       string
+		aggregator Aggregator
+		// evict removes the first point once every point was added
+		evict bool
+		want  float64
+	}{
+		{
+			name:       "test vwap",
+			aggregator: NewVWAPAggregator(),
+			want:       140.0 / 6.0,
+		},
+		{
+			name:       "test vwap after eviction",
+			aggregator: NewVWAPAggregator(),
+			evict:      true,
+			want:       130.0 / 5.0,
+		},
+		{
+			name:       "test twap",
+			aggregator: NewTWAPAggregator(),
+			want:       (10.0*1 + 20.0*3 + 40.0*1) / 5.0,
+		},
+		{
+			name:       "test twap after eviction",
+			aggregator: NewTWAPAggregator(),
+			evict:      true,
+			want:       (20.0*3 + 40.0*1) / 4.0,
+		},
+		{
+			name:       "test sma",
+			aggregator: NewSMAAggregator(),
+			want:       25.0,
+		},
+		{
+			name:       "test median even count",
+			aggregator: NewMedianAggregator(),
+			want:       25.0,
+		},
+		{
+			name:       "test median after eviction",
+			aggregator: NewMedianAggregator(),
+			evict:      true,
+			want:       30.0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, point := range points {
+				tt.aggregator.Add(point)
+			}
+			if tt.evict {
+				tt.aggregator.Evict(points[0])
+			}
+			value, _ := tt.aggregator.Value().Float64()
+			assert.InDelta(t, tt.want, value, 1e-9)
+		})
+	}
+}
+
+func TestAggregators_NoSize(t *testing.T) {
+	point := &dtos.Match{Time: time.Now(), Price: big.NewFloat(10.0), Size: big.NewFloat(0.0)}
+	tests := []struct {
+		name       string
+		aggregator Aggregator
+		// add accounts a trade of zero size before reading the value
+		add bool
+	}{
+		{
+			name:       "test empty vwap",
+			aggregator: NewVWAPAggregator(),
+		},
+		{
+			name:       "test vwap of zero size trades",
+			aggregator: NewVWAPAggregator(),
+			add:        true,
+		},
+		{
+			name:       "test empty anchored vwap",
+			aggregator: newAnchoredAggregator(),
+		},
+		{
+			name:       "test empty exponential vwap",
+			aggregator: newEWAggregator(ProductConfig{Mode: ExponentialMode, HalfLife: time.Minute}),
+		},
+		{
+			name:       "test exponential vwap of zero size trades",
+			aggregator: newEWAggregator(ProductConfig{Mode: ExponentialMode, HalfLife: time.Minute}),
+			add:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.add {
+				tt.aggregator.Add(point)
+			}
+			assert.Equal(t, 0, tt.aggregator.Value().Sign())
+		})
+	}
+}
@@ -2,6 +2,7 @@ package calculator
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"math/big"
 	"time"
@@ -13,60 +14,333 @@ var _ pkg.VWAPCalculator = &CoinbaseVWAPCalculator{}
 
 const (
 	slidingWindow = 200
-	unmarshalErr  = "unmarshal_error"
+	// eventsBuffer is how many events are kept while nobody reads them, later ones are logged instead
+	eventsBuffer = 64
+	// candlesBuffer is how many bars are kept while nobody reads them, later ones are logged instead
+	candlesBuffer = 64
 	errorType     = "error"
+	// connectionErrorType reports a lost connection, the feed is subscribed again afterwards
+	connectionErrorType = "connection_error"
 )
 
 type AvgData struct {
-	points              []*dtos.Response
-	currentPos          int64
-	CalculatedVwap      *big.Float
-	totalWeightedValues *big.Float
-	totalWeights        *big.Float
+	config ProductConfig
+	// points is the trade storage shared by every window, oldest first
+	points       []*dtos.Match
+	latest       time.Time
+	lastSequence int64
+	lastTradeId  int64
+	sessionStart time.Time
+	// rejections counts the consecutive trades rejected by the filter, lastRejected being the price of the last one
+	rejections     int
+	lastRejected   *big.Float
+	CalculatedVwap *big.Float
+	// windows holds every configured window, the first one being the primary window
+	windows []*windowData
+	// vwap is the primary window vwap, or the exponential or anchored one depending on the mode
+	vwap varianceAggregator
 }
 
-func (a *AvgData) Add(point *dtos.Response) {
+func newAvgData(config ProductConfig) *AvgData {
+	a := &AvgData{
+		config:         config,
+		CalculatedVwap: new(big.Float),
+	}
+	for _, window := range config.windows() {
+		a.windows = append(a.windows, newWindowData(window, config.Aggregators))
+	}
+	if config.ProfileBucketWidth > 0 {
+		a.windows[0].profile = newVolumeProfile(config.ProfileBucketWidth)
+	}
+	a.vwap = a.windows[0].vwap
+	switch config.Mode {
+	case ExponentialMode:
+		a.vwap = newEWAggregator(config)
+	case AnchoredMode:
+		a.vwap = newAnchoredAggregator()
+	}
+	return a
+}
+
+func (a *AvgData) Add(point *dtos.Match) {
 	// This code was refactored like this way in contrary
 	// to iterate all elements each time a new data arrives
-	mul := new(big.Float)
-	mul.Mul(point.Price, point.Size)
-	a.totalWeightedValues.Add(a.totalWeightedValues, mul)
-	a.totalWeights.Add(a.totalWeights, point.Size)
-	if a.currentPos >= slidingWindow {
-		price, size := a.points[0].Price, a.points[0].Size
-		mul := new(big.Float)
-		mul.Mul(price, size)
-		a.points = append(a.points[1:], point)
-		a.totalWeightedValues.Sub(a.totalWeightedValues, mul)
-		a.totalWeights.Sub(a.totalWeights, size)
-	} else {
-		a.points[a.currentPos] = point
-		a.currentPos++
-	}
-	a.CalculatedVwap = new(big.Float).Quo(a.totalWeightedValues, a.totalWeights)
+	a.points = append(a.points, point)
+	if point.Time.After(a.latest) {
+		a.latest = point.Time
+	}
+	var kept int
+	for _, window := range a.windows {
+		window.add(a.points, a.latest)
+		if window.count > kept {
+			kept = window.count
+		}
+	}
+	// drops the trades no window holds anymore
+	a.points = a.points[len(a.points)-kept:]
+	if a.vwap != a.windows[0].vwap {
+		a.vwap.Add(point)
+	}
+	a.lastSequence = point.Sequence
+	a.CalculatedVwap = a.vwap.Value()
+}
+
+// rollSession starts a new session when an anchored product receives a trade, or the session timer
+// fires, past the current session end, returning the record of the session that was closed, if any
+func (a *AvgData) rollSession(tradeTime time.Time) *dtos.SessionClose {
+	if a.config.Mode != AnchoredMode {
+		return nil
+	}
+	start := a.config.sessionStart(tradeTime)
+	if a.sessionStart.IsZero() {
+		a.sessionStart = start
+		return nil
+	}
+	if !start.After(a.sessionStart) {
+		return nil
+	}
+	closed := &dtos.SessionClose{
+		Start: a.sessionStart,
+		End:   a.sessionStart.Add(a.config.sessionLength()),
+		Vwap:  dtos.NewDecimal(a.CalculatedVwap),
+	}
+	a.sessionStart = start
+	a.vwap = newAnchoredAggregator()
+	a.CalculatedVwap = new(big.Float)
+	return closed
+}
+
+// bands returns the bands around the vwap of the product
+func (a *AvgData) bands(ks []float64) []dtos.Band {
+	return bandsAround(a.CalculatedVwap, a.vwap.Variance(), ks)
+}
+
+// aggregates returns the value of every configured aggregator of the primary window by name
+func (a *AvgData) aggregates() map[string]dtos.Decimal {
+	return a.windows[0].aggregates()
+}
+
+// windowResults returns the results of every window by name
+func (a *AvgData) windowResults(ks []float64) map[string]dtos.WindowAvgs {
+	results := make(map[string]dtos.WindowAvgs, len(a.windows))
+	for _, window := range a.windows {
+		results[window.window.Name()] = window.result(ks)
+	}
+	return results
+}
+
+// window returns the trades held by the widest window, oldest first
+func (a *AvgData) window() []*dtos.Match {
+	return a.points
 }
 
 type CoinbaseVWAPCalculator struct {
-	exit        chan struct{}
+	exit chan struct{}
+	// started is closed once CalcAvg runs, done once it stopped
+	started     chan struct{}
+	done        chan struct{}
 	currentTime time.Time
 	delay       float64
 	maxDelay    float64
 	productAvgs map[string]*AvgData
+	// sessionCloses are the anchored sessions closed since the last emission
+	sessionCloses []dtos.SessionClose
+	// quotes are the last best bid and ask reported by the ticker of every product
+	quotes map[string]dtos.Quote
+	// books are the level2 order books of every product, rebuilt from a snapshot after every reconnection
+	books     map[string]*OrderBook
+	bookDepth int
+	// ownFills are the windows of our own fills of every product, nil unless enabled
+	ownFills map[string]*AvgData
+
+	events chan *dtos.Event
+
+	candleBuilders []*CandleBuilder
+	candles        chan *dtos.Candle
+	// closedCandles are the bars closed by the last trade
+	closedCandles []*dtos.Candle
+
+	bands     []float64
+	triangles bool
+
+	deltaFullInterval time.Duration
+	lastFullUpdate    time.Time
+	lastEmitted       map[string]dtos.Decimal
+	defaultConfig     ProductConfig
+	productConfigs    map[string]ProductConfig
+
+	snapshotPath     string
+	snapshotInterval time.Duration
 }
 
-func (c *CoinbaseVWAPCalculator) calcAvg(data *dtos.Response) {
-	var avgdata *AvgData
-	var ok bool
-	if avgdata, ok = c.productAvgs[data.ProductId]; !ok {
-		avgdata = &AvgData{
-			points:              make([]*dtos.Response, slidingWindow),
-			CalculatedVwap:      new(big.Float),
-			totalWeightedValues: new(big.Float),
-			totalWeights:        new(big.Float),
-		}
-		c.productAvgs[data.ProductId] = avgdata
+func (c *CoinbaseVWAPCalculator) calcAvg(data *dtos.Match) {
+	avgdata := c.avgDataFor(data.ProductId)
+	// skips trades already accounted for, e.g. replayed after restoring a snapshot
+	if data.Sequence != 0 && data.Sequence <= avgdata.lastSequence {
+		return
+	}
+	// gaps are missed trades of the feed, rejected trades were received and advance the trade id as well
+	if avgdata.lastTradeId != 0 && data.TradeId > avgdata.lastTradeId+1 {
+		sequenceGaps.WithLabelValues(data.ProductId).Inc()
+	}
+	if data.TradeId > avgdata.lastTradeId {
+		avgdata.lastTradeId = data.TradeId
+	}
+	if reason := avgdata.reject(data); reason != "" {
+		avgdata.lastSequence = data.Sequence
+		c.sendEvent(&dtos.Event{
+			Type:      dtos.TradeRejectedEvent,
+			ProductId: data.ProductId,
+			Time:      data.Time,
+			Message:   reason,
+			Trade:     data,
+		})
+		return
+	}
+	if !data.Time.IsZero() {
+		calculatorLag.WithLabelValues(data.ProductId).Set(time.Since(data.Time).Seconds())
+	}
+	tradesProcessed.WithLabelValues(data.ProductId).Inc()
+	if closed := avgdata.rollSession(data.Time); closed != nil {
+		closed.ProductId = data.ProductId
+		c.sessionCloses = append(c.sessionCloses, *closed)
 	}
 	avgdata.Add(data)
+	for _, builder := range c.candleBuilders {
+		c.closedCandles = append(c.closedCandles, builder.Add(data)...)
+	}
+}
+
+// avgDataFor returns the data of the given product, creating it on its first message
+func (c *CoinbaseVWAPCalculator) avgDataFor(productId string) *AvgData {
+	avgdata, ok := c.productAvgs[productId]
+	if !ok {
+		avgdata = newAvgData(c.configFor(productId))
+		c.productAvgs[productId] = avgdata
+	}
+	return avgdata
+}
+
+// addOwnFill accounts a trade of our own orders. Both the matches and the user channels send it,
+// so the copies are told apart by trade id. Invalid fills are left out, the market side reports them.
+func (c *CoinbaseVWAPCalculator) addOwnFill(fill *dtos.Match) {
+	if c.configFor(fill.ProductId).Filter.invalid(fill) != "" {
+		return
+	}
+	avgdata, ok := c.ownFills[fill.ProductId]
+	if !ok {
+		avgdata = newAvgData(c.configFor(fill.ProductId))
+		c.ownFills[fill.ProductId] = avgdata
+	}
+	if fill.TradeId <= avgdata.lastTradeId {
+		return
+	}
+	avgdata.lastTradeId = fill.TradeId
+	avgdata.Add(fill)
+}
+
+// seedBaseline takes the last trade sent on subscribing as the sequence and trade id baseline of
+// its product, without accounting it, so the later trades are checked for gaps and replays from it
+func (c *CoinbaseVWAPCalculator) seedBaseline(lastMatch *dtos.LastMatch) {
+	avgdata := c.avgDataFor(lastMatch.ProductId)
+	if lastMatch.Sequence > avgdata.lastSequence {
+		avgdata.lastSequence = lastMatch.Sequence
+	}
+	if lastMatch.TradeId > avgdata.lastTradeId {
+		avgdata.lastTradeId = lastMatch.TradeId
+	}
+}
+
+// configFor returns the configuration of the given product, falling back to the default one
+func (c *CoinbaseVWAPCalculator) configFor(productId string) ProductConfig {
+	if config, ok := c.productConfigs[productId]; ok {
+		return config
+	}
+	return c.defaultConfig
+}
+
+// sendEvent reports the event without ever blocking the calculation.
+// The trade is copied since the original one is still held by the windows.
+func (c *CoinbaseVWAPCalculator) sendEvent(event *dtos.Event) {
+	if event.Trade != nil {
+		event.Trade = copyMatch(event.Trade)
+	}
+	select {
+	case c.events <- event:
+	default:
+		log.Printf("events channel full, dropping %s event of %s: %s", event.Type, event.ProductId, event.Message)
+	}
+}
+
+// copyMatch returns a deep copy of the trade
+func copyMatch(match *dtos.Match) *dtos.Match {
+	copied := *match
+	if match.Price != nil {
+		copied.Price = new(big.Float).Set(match.Price)
+	}
+	if match.Size != nil {
+		copied.Size = new(big.Float).Set(match.Size)
+	}
+	return &copied
+}
+
+// updateQuote keeps the best bid and ask of the ticker, they are emitted along with the next vwap
+func (c *CoinbaseVWAPCalculator) updateQuote(ticker *dtos.Ticker) {
+	if ticker == nil || ticker.BestBid == nil || ticker.BestAsk == nil {
+		return
+	}
+	c.quotes[ticker.ProductId] = dtos.Quote{
+		BestBid:   dtos.NewDecimal(ticker.BestBid),
+		BestAsk:   dtos.NewDecimal(ticker.BestAsk),
+		Spread:    dtos.NewDecimal(new(big.Float).Sub(ticker.BestAsk, ticker.BestBid)),
+		Volume24h: dtos.NewDecimal(ticker.Volume24h),
+	}
+}
+
+// updateBook applies the level2 message to the book of its product, the book is dropped until the
+// next snapshot when it turns inconsistent
+func (c *CoinbaseVWAPCalculator) updateBook(msg *dtos.Level2) {
+	if c.bookDepth <= 0 || msg == nil {
+		return
+	}
+	book, ok := c.books[msg.ProductId]
+	if !ok {
+		book = NewOrderBook()
+		c.books[msg.ProductId] = book
+	}
+	// updates are expected while the book waits for its snapshot, e.g. right after it was dropped
+	if !book.Synced() && msg.Type == l2updateType {
+		return
+	}
+	if err := book.Apply(msg); err != nil {
+		c.sendEvent(&dtos.Event{
+			Type:      dtos.BookInconsistentEvent,
+			ProductId: msg.ProductId,
+			Time:      msg.Time,
+			Message:   err.Error(),
+		})
+	}
+}
+
+// resetBooks drops the books of the products whose connection was lost, every book when none is
+// given, the snapshots sent on the new subscription rebuild them
+func (c *CoinbaseVWAPCalculator) resetBooks(productIds ...string) {
+	if len(productIds) == 0 {
+		for _, book := range c.books {
+			book.Reset()
+		}
+		return
+	}
+	for _, productId := range productIds {
+		if book, ok := c.books[productId]; ok {
+			book.Reset()
+		}
+	}
+}
+
+// Events returns the channel the calculator reports its events on, e.g. rejected trades
+func (c *CoinbaseVWAPCalculator) Events() <-chan *dtos.Event {
+	return c.events
 }
 
 // checkDelay checks if it is time to send the calculated avg
@@ -83,56 +357,258 @@ func (c *CoinbaseVWAPCalculator) checkDelay() bool {
 }
 
 // sendProductAvgs converts the currently calculated avg into the final data type
-func (c *CoinbaseVWAPCalculator) sendProductAvgs(productAvgs chan<- *dtos.ProductAvgs) {
+func (c *CoinbaseVWAPCalculator) sendProductAvgs(ctx context.Context, productAvgs chan<- *dtos.ProductAvgs) bool {
 	response := &dtos.ProductAvgs{
-		Products: make(map[string]*big.Float),
+		Products:   make(map[string]dtos.Decimal),
+		LastPrices: make(map[string]dtos.Decimal),
+		Quotes:     make(map[string]dtos.Quote),
+		Books:      make(map[string]dtos.Book),
+		OwnFills:   make(map[string]dtos.OwnFills),
+		Aggregates: make(map[string]map[string]dtos.Decimal),
+		Bands:      make(map[string][]dtos.Band),
+		Windows:    make(map[string]map[string]dtos.WindowAvgs),
+		Profiles:   make(map[string]dtos.VolumeProfile),
 	}
+	full := c.fullUpdate()
+	response.Delta = !full
+	vwaps := make(map[string]*big.Float, len(c.productAvgs))
 	for k, v := range c.productAvgs {
-		response.Products[k] = v.CalculatedVwap
+		// products whose trades were all rejected have nothing to report yet
+		if len(v.points) == 0 {
+			continue
+		}
+		vwaps[k] = v.CalculatedVwap
+		vwap := dtos.NewDecimal(v.CalculatedVwap)
+		if !full && c.lastEmitted[k] == vwap {
+			continue
+		}
+		c.lastEmitted[k] = vwap
+		response.Products[k] = vwap
+		response.LastPrices[k] = dtos.NewDecimal(v.points[len(v.points)-1].Price)
+		if quote, ok := c.quotes[k]; ok {
+			response.Quotes[k] = quote
+		}
+		if own, ok := c.ownFills[k]; ok && len(own.points) > 0 {
+			fills := dtos.OwnFills{
+				Vwap:  dtos.NewDecimal(own.CalculatedVwap),
+				Fills: own.windows[0].count,
+			}
+			if v.CalculatedVwap.Sign() != 0 {
+				deviation := new(big.Float).Sub(own.CalculatedVwap, v.CalculatedVwap)
+				fills.Deviation = dtos.NewDecimal(deviation.Quo(deviation, v.CalculatedVwap))
+			}
+			response.OwnFills[k] = fills
+		}
+		if book, ok := c.books[k]; ok {
+			if summary, ok := book.summary(c.bookDepth, v.CalculatedVwap); ok {
+				response.Books[k] = summary
+			}
+		}
+		if len(v.config.Aggregators) > 0 {
+			response.Aggregates[k] = v.aggregates()
+		}
+		if len(c.bands) > 0 {
+			response.Bands[k] = v.bands(c.bands)
+		}
+		if len(v.config.Windows) > 0 {
+			response.Windows[k] = v.windowResults(c.bands)
+		}
+		if profile := v.windows[0].profile; profile != nil {
+			response.Profiles[k] = profile.result()
+		}
+	}
+	if !full && len(response.Products) == 0 {
+		return true
+	}
+	if c.triangles {
+		response.Triangles = triangles(vwaps)
+	}
+	if !c.emit(ctx, productAvgs, response) {
+		return false
 	}
-	productAvgs <- response
+	emissions.Inc()
+	return true
+}
+
+// emit sends the response unless the calculation stops first, nobody reads the emissions anymore
+// then, it returns false in that case
+func (c *CoinbaseVWAPCalculator) emit(ctx context.Context, productAvgs chan<- *dtos.ProductAvgs, response *dtos.ProductAvgs) bool {
+	select {
+	case productAvgs <- response:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-c.exit:
+		return false
+	}
+}
+
+// fullUpdate checks if the emission has to hold every product, which is always the case
+// without delta updates, otherwise once per full interval
+func (c *CoinbaseVWAPCalculator) fullUpdate() bool {
+	if c.deltaFullInterval <= 0 {
+		return true
+	}
+	if time.Since(c.lastFullUpdate) < c.deltaFullInterval {
+		return false
+	}
+	c.lastFullUpdate = time.Now()
+	return true
+}
+
+// sendSessionCloses sends the final record of the closed anchored sessions, regardless of the delay
+func (c *CoinbaseVWAPCalculator) sendSessionCloses(ctx context.Context, productAvgs chan<- *dtos.ProductAvgs) bool {
+	response := &dtos.ProductAvgs{
+		Products:      make(map[string]dtos.Decimal),
+		SessionCloses: c.sessionCloses,
+	}
+	c.sessionCloses = nil
+	return c.emit(ctx, productAvgs, response)
+}
+
+// sendCandles sends the closed bars on the candles channel without blocking the calculation
+func (c *CoinbaseVWAPCalculator) sendCandles() {
+	for _, candle := range c.closedCandles {
+		select {
+		case c.candles <- candle:
+		default:
+			log.Printf("candles channel full, dropping %s bar of %s at %s", candle.Interval, candle.ProductId, candle.Start)
+		}
+	}
+	c.closedCandles = nil
+}
+
+// Candles returns the channel the bars configured by WithCandles are sent on, nil without candles.
+// It must be drained, bars are dropped once candlesBuffer of them are waiting.
+func (c *CoinbaseVWAPCalculator) Candles() <-chan *dtos.Candle {
+	return c.candles
 }
 
 // CalcAvg processes all the coinbase responses in real-time, calculates the avg and sends the computed avg.
-func (c *CoinbaseVWAPCalculator) CalcAvg(ctx context.Context, responseChan <-chan *dtos.Response) (<-chan *dtos.ProductAvgs, error) {
+func (c *CoinbaseVWAPCalculator) CalcAvg(ctx context.Context, responseChan <-chan dtos.Message) (<-chan *dtos.ProductAvgs, error) {
 	response := make(chan *dtos.ProductAvgs)
+	close(c.started)
 	go func() {
+		defer close(c.done)
+		var snapshotTick <-chan time.Time
+		if c.snapshotPath != "" && c.snapshotInterval > 0 {
+			ticker := time.NewTicker(c.snapshotInterval)
+			defer ticker.Stop()
+			snapshotTick = ticker.C
+		}
+		var sessions sessionTimer
+		defer sessions.stop()
 		for {
+			sessions.arm(c.nextSessionEnd())
 			select {
 			case <-c.exit:
+				c.persist()
 				return
 			case <-ctx.Done():
+				c.persist()
 				return
+			case <-snapshotTick:
+				c.persist()
+			case now := <-sessions.C():
+				sessions.fired()
+				c.closeSessions(now)
+				if len(c.sessionCloses) > 0 && !c.sendSessionCloses(ctx, response) {
+					c.persist()
+					return
+				}
 			case msg := <-responseChan:
-				//ignores empty responses
-				//TODO: Handle unmarshalErr cases
-				if *msg == (dtos.Response{}) || msg.Type == unmarshalErr {
+				queueDepth.WithLabelValues("events").Set(float64(len(c.events)))
+				queueDepth.WithLabelValues("candles").Set(float64(len(c.candles)))
+				var trade *dtos.Match
+				switch msg := msg.(type) {
+				case *dtos.Match:
+					trade = msg
+					if c.ownFills != nil && msg.UserId != "" {
+						c.addOwnFill(msg)
+					}
+				case *dtos.LastMatch:
+					c.seedBaseline(msg)
+				case *dtos.Ticker:
+					c.updateQuote(msg)
+				case *dtos.Level2:
+					c.updateBook(msg)
+				case *dtos.Error:
+					//TODO: Handle unmarshal errors
+					switch msg.Type {
+					case errorType:
+						// only the connection of the products is lost, the handler reports it
+						log.Printf("feed error of %v: %s", msg.ProductIds, msg.Message)
+					case connectionErrorType:
+						c.resetBooks(msg.ProductIds...)
+					}
+				}
+				// only trades are accounted, e.g. subscription acknowledgements are not,
+				// and empty ones are ignored
+				if trade == nil || *trade == (dtos.Match{}) {
 					continue
 				}
-				if msg.Type == errorType {
-					log.Printf(msg.Error.Message)
+				c.calcAvg(trade)
+				if len(c.sessionCloses) > 0 && !c.sendSessionCloses(ctx, response) {
+					c.persist()
 					return
 				}
-				c.calcAvg(msg)
-				if c.checkDelay() {
-					c.sendProductAvgs(response)
+				if len(c.closedCandles) > 0 {
+					c.sendCandles()
+				}
+				if c.checkDelay() && !c.sendProductAvgs(ctx, response) {
+					c.persist()
+					return
 				}
-				time.Sleep(time.Millisecond * 10)
 			}
 		}
 	}()
 	return response, nil
 }
 
+// Close stops the calculation and waits until the last snapshot, if any, has been written.
+// It returns right away when the calculation never started.
 func (c *CoinbaseVWAPCalculator) Close() {
-	c.exit <- struct{}{}
+	select {
+	case <-c.started:
+	default:
+		return
+	}
+	select {
+	case c.exit <- struct{}{}:
+	case <-c.done:
+	}
+	<-c.done
 }
 
-func NewCoinbaseCalculator(maxDelay float64) *CoinbaseVWAPCalculator {
-	return &CoinbaseVWAPCalculator{
-		exit:        make(chan struct{}),
-		productAvgs: make(map[string]*AvgData),
-		currentTime: time.Now(),
-		maxDelay:    maxDelay,
+// NewCoinbaseCalculator creates the calculator, failing on product configurations that can't be calculated
+func NewCoinbaseCalculator(maxDelay float64, opts ...Option) (*CoinbaseVWAPCalculator, error) {
+	c := &CoinbaseVWAPCalculator{
+		exit:           make(chan struct{}),
+		started:        make(chan struct{}),
+		done:           make(chan struct{}),
+		events:         make(chan *dtos.Event, eventsBuffer),
+		productAvgs:    make(map[string]*AvgData),
+		quotes:         make(map[string]dtos.Quote),
+		books:          make(map[string]*OrderBook),
+		productConfigs: make(map[string]ProductConfig),
+		lastEmitted:    make(map[string]dtos.Decimal),
+		currentTime:    time.Now(),
+		maxDelay:       maxDelay,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if err := c.defaultConfig.validate(); err != nil {
+		return nil, fmt.Errorf("default product config: %w", err)
+	}
+	for productId, config := range c.productConfigs {
+		if err := config.validate(); err != nil {
+			return nil, fmt.Errorf("product config of %s: %w", productId, err)
+		}
+	}
+	if len(c.candleBuilders) > 0 {
+		c.candles = make(chan *dtos.Candle, candlesBuffer)
 	}
+	c.restore()
+	return c, nil
 }
@@ -3,8 +3,11 @@ package calculator
 import (
 	"context"
 	"math/big"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 	"vwap/pkg/dtos"
 
 	"github.com/stretchr/testify/assert"
@@ -19,7 +22,7 @@ func TestCoinbaseVWAPCalculator_CalcAvg(t *testing.T) {
 	ctx := context.Background()
 	type args struct {
 		ctx          context.Context
-		responseChan <-chan *dtos.Response
+		responseChan <-chan dtos.Message
 	}
 	tests := []struct {
 		name     string
@@ -50,11 +53,11 @@ func TestCoinbaseVWAPCalculator_CalcAvg(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			c := NewCoinbaseCalculator(0)
+			c, _ := NewCoinbaseCalculator(0)
 			switch tt.testType {
 			case success:
-				tt.args.responseChan = func() <-chan *dtos.Response {
-					coinbaseResponses := []*dtos.Response{
+				tt.args.responseChan = func() <-chan dtos.Message {
+					coinbaseResponses := []*dtos.Match{
 						{
 							ProductId: "BTC-USD",
 							Type:      "match",
@@ -68,7 +71,7 @@ func TestCoinbaseVWAPCalculator_CalcAvg(t *testing.T) {
 							Size:      big.NewFloat(4.0),
 						},
 					}
-					response := make(chan *dtos.Response)
+					response := make(chan dtos.Message)
 					go func() {
 						for _, res := range coinbaseResponses {
 							response <- res
@@ -80,16 +83,22 @@ func TestCoinbaseVWAPCalculator_CalcAvg(t *testing.T) {
 				assert.NotNil(t, response)
 				assert.NoError(t, err)
 			case responseError:
-				tt.args.responseChan = func() <-chan *dtos.Response {
-					coinbaseResponses := []*dtos.Response{
-						{
-							Type: "error",
-							Error: dtos.Error{
-								Message: "unexpected error",
-							},
+				tt.args.responseChan = func() <-chan dtos.Message {
+					// the error of a connection does not stop the products of the other ones
+					coinbaseResponses := []dtos.Message{
+						&dtos.Error{
+							Type:       "error",
+							Message:    "unexpected error",
+							ProductIds: []string{"BTC-USD"},
+						},
+						&dtos.Match{
+							ProductId: "ETH-USD",
+							Type:      "match",
+							Price:     big.NewFloat(4.0),
+							Size:      big.NewFloat(4.0),
 						},
 					}
-					response := make(chan *dtos.Response)
+					response := make(chan dtos.Message)
 					go func() {
 						for _, res := range coinbaseResponses {
 							response <- res
@@ -100,15 +109,21 @@ func TestCoinbaseVWAPCalculator_CalcAvg(t *testing.T) {
 				response, err := c.CalcAvg(tt.args.ctx, tt.args.responseChan)
 				assert.NotNil(t, response)
 				assert.NoError(t, err)
+				select {
+				case productAvgs := <-response:
+					assert.NotEmpty(t, productAvgs.Products["ETH-USD"])
+				case <-time.After(time.Second):
+					assert.Fail(t, "the calculation stopped on the error")
+				}
 			case maxSlidingWindowReached:
 				var wg sync.WaitGroup
 
-				tt.args.responseChan = func() <-chan *dtos.Response {
+				tt.args.responseChan = func() <-chan dtos.Message {
 					cbCount := slidingWindow + 10
 					wg.Add(cbCount)
-					coinbaseResponses := make([]*dtos.Response, cbCount)
+					coinbaseResponses := make([]*dtos.Match, cbCount)
 					for i := 0; i < cbCount; i++ {
-						coinbaseResponses[i] = &dtos.Response{
+						coinbaseResponses[i] = &dtos.Match{
 
 							ProductId: "BTC-USD",
 							Type:      "match",
@@ -116,7 +131,7 @@ func TestCoinbaseVWAPCalculator_CalcAvg(t *testing.T) {
 							Size:      big.NewFloat(4.0),
 						}
 					}
-					response := make(chan *dtos.Response)
+					response := make(chan dtos.Message)
 					go func() {
 						for _, res := range coinbaseResponses {
 							wg.Done()
@@ -139,3 +154,664 @@ func TestCoinbaseVWAPCalculator_CalcAvg(t *testing.T) {
 		})
 	}
 }
+
+func TestCoinbaseVWAPCalculator_Snapshot(t *testing.T) {
+	const (
+		restoreSuccess = iota
+		restoreStalePoints
+		restoreTradeCountWindow
+		restoreExponentialTotals
+		restoreAnchoredTotals
+		restoreMissingFile
+		persistOnClose
+		persistOnCancelUnread
+		closeNotStarted
+	)
+	newPoint := func(sequence int64, tradeTime time.Time, price float64) *dtos.Match {
+		return &dtos.Match{
+			ProductId: "BTC-USD",
+			Type:      "match",
+			Sequence:  sequence,
+			Time:      tradeTime,
+			Price:     big.NewFloat(price),
+			Size:      big.NewFloat(1.0),
+		}
+	}
+	tests := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "test restore snapshot success",
+			testType: restoreSuccess,
+		},
+		{
+			name:     "test restore discards stale points",
+			testType: restoreStalePoints,
+		},
+		{
+			name:     "test restore keeps old points of trade count windows",
+			testType: restoreTradeCountWindow,
+		},
+		{
+			name:     "test restore exponentially weighted totals",
+			testType: restoreExponentialTotals,
+		},
+		{
+			name:     "test restore anchored totals",
+			testType: restoreAnchoredTotals,
+		},
+		{
+			name:     "test restore missing snapshot file",
+			testType: restoreMissingFile,
+		},
+		{
+			name:     "test snapshot persisted on close",
+			testType: persistOnClose,
+		},
+		{
+			name:     "test snapshot persisted on cancel with unread emissions",
+			testType: persistOnCancelUnread,
+		},
+		{
+			name:     "test close before the calculation started",
+			testType: closeNotStarted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshot.json")
+			now := time.Now()
+			switch tt.testType {
+			case restoreSuccess:
+				c, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute))
+				c.calcAvg(newPoint(1, now, 2.0))
+				c.calcAvg(newPoint(2, now, 4.0))
+				c.persist()
+
+				restored, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute))
+				avgdata := restored.productAvgs["BTC-USD"]
+				assert.NotNil(t, avgdata)
+				assert.Equal(t, int64(2), avgdata.lastSequence)
+				vwap, _ := avgdata.CalculatedVwap.Float64()
+				assert.Equal(t, 3.0, vwap)
+				// already seen sequences are not counted twice
+				restored.calcAvg(newPoint(2, now, 4.0))
+				assert.Len(t, avgdata.points, 2)
+			case restoreStalePoints:
+				c, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute))
+				c.calcAvg(newPoint(1, now.Add(-time.Hour), 100.0))
+				c.calcAvg(newPoint(2, now, 4.0))
+				c.persist()
+
+				restored, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute),
+					WithDefaultProductConfig(ProductConfig{Windows: []Window{{Trades: 200, Duration: time.Minute}}}))
+				avgdata := restored.productAvgs["BTC-USD"]
+				assert.NotNil(t, avgdata)
+				assert.Len(t, avgdata.points, 1)
+				vwap, _ := avgdata.CalculatedVwap.Float64()
+				assert.Equal(t, 4.0, vwap)
+			case restoreTradeCountWindow:
+				c, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute))
+				c.calcAvg(newPoint(1, now.Add(-time.Hour), 2.0))
+				c.calcAvg(newPoint(2, now, 4.0))
+				c.persist()
+
+				restored, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute),
+					WithDefaultProductConfig(ProductConfig{Windows: []Window{{Trades: 200}, {Duration: time.Minute}}}))
+				avgdata := restored.productAvgs["BTC-USD"]
+				assert.NotNil(t, avgdata)
+				assert.Len(t, avgdata.points, 2)
+				vwap, _ := avgdata.CalculatedVwap.Float64()
+				assert.Equal(t, 3.0, vwap)
+			case restoreExponentialTotals:
+				// the window only holds the last trade, the weight of the previous ones is in the totals
+				config := ProductConfig{Mode: ExponentialMode, HalfLifeTrades: 1, Windows: []Window{{Trades: 1}}}
+				c, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute), WithDefaultProductConfig(config))
+				c.calcAvg(newPoint(1, now, 2.0))
+				c.calcAvg(newPoint(2, now, 4.0))
+				c.calcAvg(newPoint(3, now, 10.0))
+				c.persist()
+
+				restored, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute), WithDefaultProductConfig(config))
+				avgdata := restored.productAvgs["BTC-USD"]
+				assert.NotNil(t, avgdata)
+				assert.Len(t, avgdata.points, 1)
+				vwap, _ := avgdata.CalculatedVwap.Float64()
+				assert.InDelta(t, 12.5/1.75, vwap, 1e-9)
+			case restoreAnchoredTotals:
+				config := ProductConfig{Mode: AnchoredMode, Windows: []Window{{Trades: 1}}}
+				c, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute), WithDefaultProductConfig(config))
+				c.calcAvg(newPoint(1, now, 2.0))
+				c.calcAvg(newPoint(2, now, 4.0))
+				c.persist()
+
+				restored, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute), WithDefaultProductConfig(config))
+				avgdata := restored.productAvgs["BTC-USD"]
+				assert.NotNil(t, avgdata)
+				assert.Len(t, avgdata.points, 1)
+				assert.Equal(t, c.productAvgs["BTC-USD"].sessionStart, avgdata.sessionStart)
+				vwap, _ := avgdata.CalculatedVwap.Float64()
+				assert.Equal(t, 3.0, vwap)
+			case restoreMissingFile:
+				c, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Minute))
+				assert.Empty(t, c.productAvgs)
+			case persistOnClose:
+				c, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Hour))
+				responseChan := make(chan dtos.Message)
+				_, err := c.CalcAvg(context.Background(), responseChan)
+				assert.NoError(t, err)
+				c.Close()
+				_, err = os.Stat(path)
+				assert.NoError(t, err)
+			case persistOnCancelUnread:
+				c, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Hour))
+				ctx, cancel := context.WithCancel(context.Background())
+				responseChan := make(chan dtos.Message)
+				_, err := c.CalcAvg(ctx, responseChan)
+				assert.NoError(t, err)
+				// the emission of the trade is never read
+				responseChan <- newPoint(1, now, 2.0)
+				cancel()
+				closed := make(chan struct{})
+				go func() {
+					c.Close()
+					close(closed)
+				}()
+				select {
+				case <-closed:
+				case <-time.After(2 * time.Second):
+					assert.FailNow(t, "close did not return")
+				}
+				_, err = os.Stat(path)
+				assert.NoError(t, err)
+			case closeNotStarted:
+				c, _ := NewCoinbaseCalculator(0, WithSnapshot(path, time.Hour))
+				closed := make(chan struct{})
+				go func() {
+					c.Close()
+					close(closed)
+				}()
+				select {
+				case <-closed:
+				case <-time.After(2 * time.Second):
+					assert.Fail(t, "close did not return")
+				}
+			}
+		})
+	}
+}
+
+func TestAvgData_ExponentialMode(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name   string
+		config ProductConfig
+		times  []time.Time
+		want   float64
+	}{
+		{
+			name:   "test half life in trades",
+			config: ProductConfig{Mode: ExponentialMode, HalfLifeTrades: 1},
+			times:  []time.Time{start, start},
+			want:   5.0 / 1.5,
+		},
+		{
+			name:   "test half life in time",
+			config: ProductConfig{Mode: ExponentialMode, HalfLife: time.Minute},
+			times:  []time.Time{start, start.Add(time.Minute)},
+			want:   5.0 / 1.5,
+		},
+		{
+			name:   "test sliding window mode",
+			config: ProductConfig{Mode: SlidingWindowMode, HalfLife: time.Minute},
+			times:  []time.Time{start, start.Add(time.Minute)},
+			want:   3.0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewCoinbaseCalculator(0, WithProductConfig("BTC-USD", tt.config))
+			for i, price := range []float64{2.0, 4.0} {
+				c.calcAvg(&dtos.Match{
+					ProductId: "BTC-USD",
+					Type:      "match",
+					Time:      tt.times[i],
+					Price:     big.NewFloat(price),
+					Size:      big.NewFloat(1.0),
+				})
+			}
+			vwap, _ := c.productAvgs["BTC-USD"].CalculatedVwap.Float64()
+			assert.InDelta(t, tt.want, vwap, 1e-9)
+		})
+	}
+}
+
+func TestNewCoinbaseCalculator_ProductConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     Option
+		wantErr bool
+	}{
+		{
+			name: "test exponential mode with a half life",
+			opt:  WithDefaultProductConfig(ProductConfig{Mode: ExponentialMode, HalfLifeTrades: 10}),
+		},
+		{
+			name:    "test default exponential mode without half life",
+			opt:     WithDefaultProductConfig(ProductConfig{Mode: ExponentialMode}),
+			wantErr: true,
+		},
+		{
+			name:    "test product exponential mode without half life",
+			opt:     WithProductConfig("BTC-USD", ProductConfig{Mode: ExponentialMode}),
+			wantErr: true,
+		},
+		{
+			name: "test windows bounded by trades, duration or both",
+			opt: WithDefaultProductConfig(ProductConfig{
+				Windows: []Window{{Trades: 200}, {Duration: time.Minute}, {Trades: 200, Duration: time.Minute}},
+			}),
+		},
+		{
+			name:    "test unbounded window",
+			opt:     WithDefaultProductConfig(ProductConfig{Windows: []Window{{Trades: 200}, {}}}),
+			wantErr: true,
+		},
+		{
+			name:    "test window with a negative bound",
+			opt:     WithProductConfig("BTC-USD", ProductConfig{Windows: []Window{{Trades: 200, Duration: -time.Minute}}}),
+			wantErr: true,
+		},
+		{
+			name:    "test windows with the same name",
+			opt:     WithDefaultProductConfig(ProductConfig{Windows: []Window{{Duration: time.Minute}, {Duration: 60 * time.Second}}}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCoinbaseCalculator(0, tt.opt)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, c)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, c)
+		})
+	}
+}
+
+func TestCoinbaseVWAPCalculator_Aggregates(t *testing.T) {
+	c, _ := NewCoinbaseCalculator(0, WithDefaultProductConfig(ProductConfig{
+		Aggregators: []AggregatorFactory{NewTWAPAggregator, NewSMAAggregator, NewMedianAggregator},
+	}))
+	for _, price := range []float64{2.0, 4.0, 9.0} {
+		c.calcAvg(&dtos.Match{
+			ProductId: "BTC-USD",
+			Type:      "match",
+			Price:     big.NewFloat(price),
+			Size:      big.NewFloat(1.0),
+		})
+	}
+	response := make(chan *dtos.ProductAvgs, 1)
+	c.sendProductAvgs(context.Background(), response)
+	productAvgs := <-response
+	aggregates := productAvgs.Aggregates["BTC-USD"]
+	assert.Len(t, aggregates, 3)
+	sma := aggregates["sma"].Float64()
+	assert.Equal(t, 5.0, sma)
+	median := aggregates["median"].Float64()
+	assert.Equal(t, 4.0, median)
+	vwap := productAvgs.Products["BTC-USD"].Float64()
+	assert.Equal(t, 5.0, vwap)
+}
+
+func TestCoinbaseVWAPCalculator_Bands(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ProductConfig
+	}{
+		{
+			name:   "test bands sliding window mode",
+			config: ProductConfig{Mode: SlidingWindowMode},
+		},
+		{
+			// trades without time don't decay with a half life in time
+			name:   "test bands exponential mode",
+			config: ProductConfig{Mode: ExponentialMode, HalfLife: time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewCoinbaseCalculator(0, WithBands(1, 2), WithDefaultProductConfig(tt.config))
+			for _, price := range []float64{2.0, 4.0} {
+				c.calcAvg(&dtos.Match{
+					ProductId: "BTC-USD",
+					Type:      "match",
+					Price:     big.NewFloat(price),
+					Size:      big.NewFloat(1.0),
+				})
+			}
+			response := make(chan *dtos.ProductAvgs, 1)
+			c.sendProductAvgs(context.Background(), response)
+			bands := (<-response).Bands["BTC-USD"]
+			assert.Len(t, bands, 2)
+			for i, want := range [][2]float64{{4.0, 2.0}, {5.0, 1.0}} {
+				upper := bands[i].Upper.Float64()
+				lower := bands[i].Lower.Float64()
+				assert.InDelta(t, want[0], upper, 1e-9)
+				assert.InDelta(t, want[1], lower, 1e-9)
+			}
+		})
+	}
+}
+
+func TestCoinbaseVWAPCalculator_AnchoredMode(t *testing.T) {
+	day := time.Date(2021, 10, 7, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		config ProductConfig
+		times  []time.Time
+		// closes is the expected amount of closed sessions after every trade
+		closes    []int
+		wantVwap  float64
+		wantClose *dtos.SessionClose
+	}{
+		{
+			name:      "test session reset at utc midnight",
+			config:    ProductConfig{Mode: AnchoredMode},
+			times:     []time.Time{day.Add(10 * time.Hour), day.Add(20 * time.Hour), day.Add(25 * time.Hour)},
+			closes:    []int{0, 0, 1},
+			wantVwap:  10.0,
+			wantClose: &dtos.SessionClose{ProductId: "BTC-USD", Start: day, End: day.Add(24 * time.Hour)},
+		},
+		{
+			name:     "test custom session anchor",
+			config:   ProductConfig{Mode: AnchoredMode, SessionAnchor: 14*time.Hour + 30*time.Minute},
+			times:    []time.Time{day.Add(15 * time.Hour), day.Add(20 * time.Hour), day.Add(38 * time.Hour)},
+			closes:   []int{0, 0, 0},
+			wantVwap: 16.0 / 3.0,
+		},
+		{
+			name:      "test custom session length",
+			config:    ProductConfig{Mode: AnchoredMode, SessionLength: time.Hour},
+			times:     []time.Time{day, day.Add(30 * time.Minute), day.Add(90 * time.Minute)},
+			closes:    []int{0, 0, 1},
+			wantVwap:  10.0,
+			wantClose: &dtos.SessionClose{ProductId: "BTC-USD", Start: day, End: day.Add(time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewCoinbaseCalculator(0, WithProductConfig("BTC-USD", tt.config))
+			for i, price := range []float64{2.0, 4.0, 10.0} {
+				c.calcAvg(&dtos.Match{
+					ProductId: "BTC-USD",
+					Type:      "match",
+					Time:      tt.times[i],
+					Price:     big.NewFloat(price),
+					Size:      big.NewFloat(1.0),
+				})
+				assert.Len(t, c.sessionCloses, tt.closes[i])
+			}
+			vwap, _ := c.productAvgs["BTC-USD"].CalculatedVwap.Float64()
+			assert.InDelta(t, tt.wantVwap, vwap, 1e-9)
+			if tt.wantClose == nil {
+				return
+			}
+			response := make(chan *dtos.ProductAvgs, 1)
+			c.sendSessionCloses(context.Background(), response)
+			closed := (<-response).SessionCloses[0]
+			assert.Equal(t, tt.wantClose.ProductId, closed.ProductId)
+			assert.Equal(t, tt.wantClose.Start, closed.Start)
+			assert.Equal(t, tt.wantClose.End, closed.End)
+			closedVwap := closed.Vwap.Float64()
+			assert.Equal(t, 3.0, closedVwap)
+			assert.Empty(t, c.sessionCloses)
+		})
+	}
+}
+
+func TestCoinbaseVWAPCalculator_SessionTimer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, _ := NewCoinbaseCalculator(0, WithProductConfig("BTC-USD", ProductConfig{
+		Mode:          AnchoredMode,
+		SessionLength: 100 * time.Millisecond,
+	}))
+	responseChan := make(chan dtos.Message)
+	response, err := c.CalcAvg(ctx, responseChan)
+	assert.NoError(t, err)
+	responseChan <- &dtos.Match{
+		ProductId: "BTC-USD",
+		Type:      "match",
+		Time:      time.Now(),
+		Price:     big.NewFloat(2.0),
+		Size:      big.NewFloat(1.0),
+	}
+	// no other trade arrives, the session closes at its anchor anyway
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case productAvgs := <-response:
+			if len(productAvgs.SessionCloses) == 0 {
+				continue
+			}
+			closed := productAvgs.SessionCloses[0]
+			assert.Equal(t, "BTC-USD", closed.ProductId)
+			assert.Equal(t, 100*time.Millisecond, closed.End.Sub(closed.Start))
+			assert.Equal(t, 2.0, closed.Vwap.Float64())
+			return
+		case <-timeout:
+			assert.Fail(t, "the session was not closed")
+			return
+		}
+	}
+}
+
+func TestCoinbaseVWAPCalculator_DeltaUpdates(t *testing.T) {
+	c, _ := NewCoinbaseCalculator(0, WithDeltaUpdates(time.Hour))
+	trade := func(productId string, price float64) *dtos.Match {
+		return &dtos.Match{
+			ProductId: productId,
+			Type:      "match",
+			Price:     big.NewFloat(price),
+			Size:      big.NewFloat(1.0),
+		}
+	}
+	response := make(chan *dtos.ProductAvgs, 1)
+	c.calcAvg(trade("BTC-USD", 4.0))
+	c.calcAvg(trade("ETH-USD", 2.0))
+	// the first emission is a full one
+	c.sendProductAvgs(context.Background(), response)
+	productAvgs := <-response
+	assert.False(t, productAvgs.Delta)
+	assert.Len(t, productAvgs.Products, 2)
+
+	c.calcAvg(trade("ETH-USD", 4.0))
+	c.sendProductAvgs(context.Background(), response)
+	productAvgs = <-response
+	assert.True(t, productAvgs.Delta)
+	assert.Len(t, productAvgs.Products, 1)
+	assert.NotNil(t, productAvgs.Products["ETH-USD"])
+
+	// trades that leave the vwap unchanged are not emitted
+	c.calcAvg(trade("BTC-USD", 4.0))
+	c.sendProductAvgs(context.Background(), response)
+	assert.Empty(t, response)
+
+	// the full interval elapsed
+	c.lastFullUpdate = time.Now().Add(-time.Hour)
+	c.sendProductAvgs(context.Background(), response)
+	productAvgs = <-response
+	assert.False(t, productAvgs.Delta)
+	assert.Len(t, productAvgs.Products, 2)
+}
+
+func TestCoinbaseVWAPCalculator_Quotes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, _ := NewCoinbaseCalculator(0)
+	responseChan := make(chan dtos.Message)
+	productAvgs, err := c.CalcAvg(ctx, responseChan)
+	assert.NoError(t, err)
+	responseChan <- &dtos.Ticker{
+		Type:      "ticker",
+		ProductId: "BTC-USD",
+		BestBid:   big.NewFloat(99.5),
+		BestAsk:   big.NewFloat(100.25),
+		Volume24h: big.NewFloat(1234.5),
+	}
+	responseChan <- &dtos.Match{
+		ProductId: "BTC-USD",
+		Type:      "match",
+		Price:     big.NewFloat(100.0),
+		Size:      big.NewFloat(1.0),
+	}
+	response := <-productAvgs
+	assert.Equal(t, dtos.Quote{
+		BestBid:   "99.5",
+		BestAsk:   "100.25",
+		Spread:    "0.75",
+		Volume24h: "1234.5",
+	}, response.Quotes["BTC-USD"])
+	// the ticker is not a trade
+	assert.Len(t, c.productAvgs["BTC-USD"].points, 1)
+}
+
+func TestCoinbaseVWAPCalculator_OrderBook(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, _ := NewCoinbaseCalculator(0, WithOrderBook(1))
+	responseChan := make(chan dtos.Message)
+	productAvgs, err := c.CalcAvg(ctx, responseChan)
+	assert.NoError(t, err)
+	level2 := func(msg *dtos.Level2) *dtos.Level2 {
+		msg.ProductId = "BTC-USD"
+		return msg
+	}
+	match := &dtos.Match{
+		ProductId: "BTC-USD",
+		Type:      "match",
+		Price:     big.NewFloat(101.0),
+		Size:      big.NewFloat(1.0),
+	}
+	responseChan <- level2(&dtos.Level2{
+		Type: "snapshot",
+		Bids: [][2]string{{"99", "1"}, {"98", "1"}},
+		Asks: [][2]string{{"101", "1"}},
+	})
+	responseChan <- match
+	book := (<-productAvgs).Books["BTC-USD"]
+	assert.Equal(t, dtos.Book{
+		Bids:             []dtos.BookLevel{{Price: "99", Size: "1"}},
+		Asks:             []dtos.BookLevel{{Price: "101", Size: "1"}},
+		Mid:              "100",
+		Microprice:       "100",
+		VwapMidDeviation: "0.01",
+	}, book)
+
+	// a crossed book is reported and dropped until the next snapshot
+	responseChan <- level2(&dtos.Level2{Type: "l2update", Changes: [][3]string{{"sell", "98", "1"}}})
+	event := <-c.Events()
+	assert.Equal(t, dtos.BookInconsistentEvent, event.Type)
+	responseChan <- match
+	assert.NotContains(t, (<-productAvgs).Books, "BTC-USD")
+
+	responseChan <- level2(&dtos.Level2{
+		Type: "snapshot",
+		Bids: [][2]string{{"99", "1"}},
+		Asks: [][2]string{{"101", "1"}},
+	})
+	responseChan <- match
+	assert.Contains(t, (<-productAvgs).Books, "BTC-USD")
+
+	// a connection carrying other products leaves the book as is
+	responseChan <- &dtos.Error{Type: "connection_error", ProductIds: []string{"ETH-USD"}}
+	responseChan <- match
+	assert.Contains(t, (<-productAvgs).Books, "BTC-USD")
+
+	// the books are rebuilt from the snapshots sent after a reconnection
+	responseChan <- &dtos.Error{Type: "connection_error"}
+	responseChan <- level2(&dtos.Level2{Type: "l2update", Changes: [][3]string{{"buy", "99", "2"}}})
+	responseChan <- match
+	assert.NotContains(t, (<-productAvgs).Books, "BTC-USD")
+	select {
+	case event := <-c.Events():
+		t.Fatalf("unexpected event %v", event)
+	default:
+	}
+}
+
+func TestCoinbaseVWAPCalculator_LastMatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, _ := NewCoinbaseCalculator(0)
+	responseChan := make(chan dtos.Message)
+	productAvgs, err := c.CalcAvg(ctx, responseChan)
+	assert.NoError(t, err)
+	match := func(sequence, tradeId int64, price float64) dtos.Match {
+		return dtos.Match{
+			ProductId: "LAST-USD",
+			Sequence:  sequence,
+			TradeId:   tradeId,
+			Price:     big.NewFloat(price),
+			Size:      big.NewFloat(1.0),
+		}
+	}
+	gaps := sequenceGaps.WithLabelValues("LAST-USD").Value()
+	lastMatch := &dtos.LastMatch{Match: match(10, 100, 50.0)}
+	lastMatch.Type = "last_match"
+	responseChan <- lastMatch
+	// trades up to the baseline were already sent before subscribing
+	older := match(9, 99, 10.0)
+	responseChan <- &older
+	assert.NotContains(t, (<-productAvgs).Products, "LAST-USD")
+	next := match(11, 101, 20.0)
+	responseChan <- &next
+	response := <-productAvgs
+	// the last match seeds the baseline but is not accounted
+	assert.Equal(t, dtos.Decimal("20"), response.Products["LAST-USD"])
+	assert.Len(t, c.productAvgs["LAST-USD"].points, 1)
+	assert.Equal(t, gaps, sequenceGaps.WithLabelValues("LAST-USD").Value())
+}
+
+func TestCoinbaseVWAPCalculator_OwnFills(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, _ := NewCoinbaseCalculator(0, WithOwnFills())
+	responseChan := make(chan dtos.Message)
+	productAvgs, err := c.CalcAvg(ctx, responseChan)
+	assert.NoError(t, err)
+	trade := func(sequence int64, price float64, userId string) *dtos.Match {
+		return &dtos.Match{
+			Type:      "match",
+			ProductId: "BTC-USD",
+			Sequence:  sequence,
+			TradeId:   sequence,
+			Price:     big.NewFloat(price),
+			Size:      big.NewFloat(1.0),
+			UserId:    userId,
+		}
+	}
+	responseChan <- trade(1, 100.0, "")
+	<-productAvgs
+	responseChan <- trade(2, 104.0, "user")
+	<-productAvgs
+	// the user channel sends our fill again
+	responseChan <- trade(2, 104.0, "user")
+	<-productAvgs
+	// a fill without price and size is left out of our own fills
+	responseChan <- &dtos.Match{Type: "match", ProductId: "BTC-USD", Sequence: 3, TradeId: 3, UserId: "user"}
+	<-productAvgs
+	responseChan <- trade(4, 102.0, "")
+	response := <-productAvgs
+	assert.Equal(t, dtos.Decimal("102"), response.Products["BTC-USD"])
+	assert.Equal(t, dtos.OwnFills{
+		Vwap:      "104",
+		Fills:     1,
+		Deviation: dtos.NewDecimal(new(big.Float).Quo(big.NewFloat(2), big.NewFloat(102))),
+	}, response.OwnFills["BTC-USD"])
+}
@@ -0,0 +1,118 @@
+package calculator
+
+import (
+	"math/big"
+	"time"
+	"vwap/pkg/dtos"
+)
+
+// candleData is the bar being built for a product
+type candleData struct {
+	productId           string
+	interval            time.Duration
+	start               time.Time
+	end                 time.Time
+	open                *big.Float
+	high                *big.Float
+	low                 *big.Float
+	close               *big.Float
+	volume              *big.Float
+	totalWeightedValues *big.Float
+	trades              int
+}
+
+// CandleBuilder builds the OHLCV bars of a single interval for every product.
+// Bars are aligned to the interval and close on trade time, when the first trade past
+// their end arrives, so the intervals without trades are emitted as a single flat empty bar
+// spanning all of them, however long the gap.
+type CandleBuilder struct {
+	interval time.Duration
+	current  map[string]*candleData
+}
+
+// NewCandleBuilder creates a builder of bars of the given interval
+func NewCandleBuilder(interval time.Duration) *CandleBuilder {
+	return &CandleBuilder{
+		interval: interval,
+		current:  make(map[string]*candleData),
+	}
+}
+
+// Add accounts the trade and returns the bars it closed, oldest first
+func (b *CandleBuilder) Add(point *dtos.Match) []*dtos.Candle {
+	start := point.Time.Truncate(b.interval)
+	current, ok := b.current[point.ProductId]
+	if !ok {
+		current = b.open(point.ProductId, start, point.Price)
+		b.current[point.ProductId] = current
+	}
+	// late trades belong to a bar that was already emitted
+	if start.Before(current.start) {
+		return nil
+	}
+	var closed []*dtos.Candle
+	if start.After(current.start) {
+		closed = append(closed, current.result())
+		if start.After(current.end) {
+			gap := b.open(point.ProductId, current.end, current.close)
+			gap.end = start
+			closed = append(closed, gap.result())
+		}
+		current = b.open(point.ProductId, start, current.close)
+		b.current[point.ProductId] = current
+	}
+	current.add(point)
+	return closed
+}
+
+// open starts an empty bar whose prices are the previous close
+func (b *CandleBuilder) open(productId string, start time.Time, price *big.Float) *candleData {
+	return &candleData{
+		productId:           productId,
+		interval:            b.interval,
+		start:               start,
+		end:                 start.Add(b.interval),
+		open:                price,
+		high:                price,
+		low:                 price,
+		close:               price,
+		volume:              new(big.Float),
+		totalWeightedValues: new(big.Float),
+	}
+}
+
+func (c *candleData) add(point *dtos.Match) {
+	if c.trades == 0 {
+		c.open, c.high, c.low = point.Price, point.Price, point.Price
+	}
+	if point.Price.Cmp(c.high) > 0 {
+		c.high = point.Price
+	}
+	if point.Price.Cmp(c.low) < 0 {
+		c.low = point.Price
+	}
+	c.close = point.Price
+	c.volume.Add(c.volume, point.Size)
+	c.totalWeightedValues.Add(c.totalWeightedValues, new(big.Float).Mul(point.Price, point.Size))
+	c.trades++
+}
+
+// result converts the bar into its emitted form, empty bars have no vwap
+func (c *candleData) result() *dtos.Candle {
+	candle := &dtos.Candle{
+		ProductId: c.productId,
+		Interval:  c.interval,
+		Start:     c.start,
+		End:       c.end,
+		Open:      dtos.NewDecimal(c.open),
+		High:      dtos.NewDecimal(c.high),
+		Low:       dtos.NewDecimal(c.low),
+		Close:     dtos.NewDecimal(c.close),
+		Volume:    dtos.NewDecimal(c.volume),
+		Trades:    c.trades,
+	}
+	if c.trades > 0 && c.volume.Sign() > 0 {
+		candle.Vwap = dtos.NewDecimal(new(big.Float).Quo(c.totalWeightedValues, c.volume))
+	}
+	return candle
+}
@@ -0,0 +1,106 @@
+package calculator
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandleBuilder_Add(t *testing.T) {
+	start := time.Date(2021, 10, 7, 10, 0, 0, 0, time.UTC)
+	trade := func(offset time.Duration, price, size float64) *dtos.Match {
+		return &dtos.Match{
+			ProductId: "BTC-USD",
+			Time:      start.Add(offset),
+			Price:     big.NewFloat(price),
+			Size:      big.NewFloat(size),
+		}
+	}
+	b := NewCandleBuilder(time.Minute)
+	assert.Empty(t, b.Add(trade(10*time.Second, 10.0, 1.0)))
+	assert.Empty(t, b.Add(trade(20*time.Second, 14.0, 1.0)))
+	assert.Empty(t, b.Add(trade(30*time.Second, 8.0, 2.0)))
+	// late trades of an already closed bar are dropped
+	closed := b.Add(trade(3*time.Minute+5*time.Second, 12.0, 1.0))
+	assert.Empty(t, b.Add(trade(-time.Minute, 100.0, 1.0)))
+
+	assert.Len(t, closed, 2)
+	first := closed[0]
+	assert.Equal(t, start, first.Start)
+	assert.Equal(t, start.Add(time.Minute), first.End)
+	assert.Equal(t, 3, first.Trades)
+	for _, tt := range []struct {
+		got  dtos.Decimal
+		want float64
+	}{
+		{got: first.Open, want: 10.0},
+		{got: first.High, want: 14.0},
+		{got: first.Low, want: 8.0},
+		{got: first.Close, want: 8.0},
+		{got: first.Volume, want: 4.0},
+		{got: first.Vwap, want: 40.0 / 4.0},
+	} {
+		value := tt.got.Float64()
+		assert.Equal(t, tt.want, value)
+	}
+	// the intervals without trades are a single flat bar at the previous close
+	empty := closed[1]
+	assert.Equal(t, 0, empty.Trades)
+	assert.Empty(t, empty.Vwap)
+	for _, price := range []dtos.Decimal{empty.Open, empty.High, empty.Low, empty.Close} {
+		value := price.Float64()
+		assert.Equal(t, 8.0, value)
+	}
+	assert.Equal(t, start.Add(time.Minute), empty.Start)
+	assert.Equal(t, start.Add(3*time.Minute), empty.End)
+}
+
+func TestCandleBuilder_LongGap(t *testing.T) {
+	start := time.Date(2021, 10, 7, 10, 0, 0, 0, time.UTC)
+	b := NewCandleBuilder(time.Second)
+	var closed []*dtos.Candle
+	for _, offset := range []time.Duration{0, 24 * time.Hour} {
+		closed = b.Add(&dtos.Match{
+			ProductId: "BTC-USD",
+			Time:      start.Add(offset),
+			Price:     big.NewFloat(4.0),
+			Size:      big.NewFloat(1.0),
+		})
+	}
+	// a single empty bar covers the day without trades instead of one bar per second
+	assert.Len(t, closed, 2)
+	assert.Equal(t, start.Add(time.Second), closed[1].Start)
+	assert.Equal(t, start.Add(24*time.Hour), closed[1].End)
+}
+
+func TestCoinbaseVWAPCalculator_Candles(t *testing.T) {
+	start := time.Date(2021, 10, 7, 10, 0, 0, 0, time.UTC)
+	c, _ := NewCoinbaseCalculator(0, WithCandles(time.Second))
+	assert.NotNil(t, c.Candles())
+	responseChan := make(chan dtos.Message)
+	productAvgs, err := c.CalcAvg(context.Background(), responseChan)
+	assert.NoError(t, err)
+	go func() {
+		for range productAvgs {
+			continue
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		responseChan <- &dtos.Match{
+			ProductId: "BTC-USD",
+			Type:      "match",
+			Time:      start.Add(time.Duration(i) * time.Second),
+			Price:     big.NewFloat(4.0),
+			Size:      big.NewFloat(1.0),
+		}
+	}
+	candle := <-c.Candles()
+	assert.Equal(t, "BTC-USD", candle.ProductId)
+	assert.Equal(t, start, candle.Start)
+	assert.Equal(t, 1, candle.Trades)
+	c.Close()
+}
@@ -0,0 +1,99 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Mode selects how the vwap of a product is accumulated
+type Mode int
+
+const (
+	// SlidingWindowMode averages the last slidingWindow trades with equal weight
+	SlidingWindowMode Mode = iota
+	// ExponentialMode decays the weight of every trade with its age, HalfLife or HalfLifeTrades is required
+	ExponentialMode
+	// AnchoredMode accumulates every trade since the session anchor and resets when the session ends
+	AnchoredMode
+)
+
+const defaultSessionLength = 24 * time.Hour
+
+// ProductConfig defines how the vwap of a product is calculated
+type ProductConfig struct {
+	Mode Mode
+	// HalfLife is the trade time after which a trade weighs half, used by ExponentialMode
+	HalfLife time.Duration
+	// HalfLifeTrades is the number of newer trades after which a trade weighs half, used by ExponentialMode
+	HalfLifeTrades int
+	// SessionAnchor is the offset from UTC midnight at which sessions start, used by AnchoredMode
+	SessionAnchor time.Duration
+	// SessionLength is the length of every session, one day when zero, used by AnchoredMode
+	SessionLength time.Duration
+	// Windows are the sliding windows kept for the product, sharing the same trades.
+	// The first one is the primary window, a single window of slidingWindow trades when empty.
+	// Windows always slide, Mode only applies to the primary vwap. Every window needs a bound and a distinct name.
+	Windows []Window
+	// ProfileBucketWidth enables the volume profile of the primary window with buckets of the given price width
+	ProfileBucketWidth float64
+	// Filter rejects erroneous trades, reported on the event stream
+	Filter TradeFilter
+	// Aggregators adds metrics computed over every window, emitted by name alongside the vwap
+	Aggregators []AggregatorFactory
+}
+
+// validate rejects the configurations that can't produce a meaningful vwap
+func (p ProductConfig) validate() error {
+	if p.Mode == ExponentialMode && p.HalfLife <= 0 && p.HalfLifeTrades <= 0 {
+		return errors.New("exponential mode requires a positive half life or half life in trades")
+	}
+	// an unbounded window never evicts, the trades shared by every window would grow forever
+	names := make(map[string]bool, len(p.Windows))
+	for _, window := range p.Windows {
+		if window.Trades < 0 || window.Duration < 0 || (window.Trades == 0 && window.Duration == 0) {
+			return fmt.Errorf("window %+v requires positive trades or duration and no negative bound", window)
+		}
+		// results are emitted by window name
+		if names[window.Name()] {
+			return fmt.Errorf("window %s is defined twice", window.Name())
+		}
+		names[window.Name()] = true
+	}
+	return nil
+}
+
+func (p ProductConfig) windows() []Window {
+	if len(p.Windows) == 0 {
+		return []Window{{Trades: slidingWindow}}
+	}
+	return p.Windows
+}
+
+// retention is the trade time covered by the widest window, zero when a window is only bounded by
+// trade count since its trades never expire with time
+func (p ProductConfig) retention() time.Duration {
+	var retention time.Duration
+	for _, window := range p.windows() {
+		if window.Duration <= 0 {
+			return 0
+		}
+		if window.Duration > retention {
+			retention = window.Duration
+		}
+	}
+	return retention
+}
+
+func (p ProductConfig) sessionLength() time.Duration {
+	if p.SessionLength <= 0 {
+		return defaultSessionLength
+	}
+	return p.SessionLength
+}
+
+// sessionStart returns the start of the session the given trade time belongs to.
+// Truncate works since the zero time, which is an UTC midnight, so daily sessions start at the anchor.
+func (p ProductConfig) sessionStart(tradeTime time.Time) time.Time {
+	return tradeTime.UTC().Add(-p.SessionAnchor).Truncate(p.sessionLength()).Add(p.SessionAnchor)
+}
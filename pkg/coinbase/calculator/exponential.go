@@ -0,0 +1,74 @@
+package calculator
+
+import (
+	"math"
+	"math/big"
+	"time"
+	"vwap/pkg/dtos"
+)
+
+// ewAggregator is the exponentially weighted vwap, see ExponentialMode.
+// There is no eviction: every new trade decays the previous totals according to the
+// elapsed trade time and/or the trade count, so old trades fade out instead of dropping.
+type ewAggregator struct {
+	halfLife             time.Duration
+	halfLifeTrades       int
+	lastTime             time.Time
+	totalWeightedValues  *big.Float
+	totalWeights         *big.Float
+	totalWeightedSquares *big.Float
+}
+
+func newEWAggregator(config ProductConfig) *ewAggregator {
+	return &ewAggregator{
+		halfLife:             config.HalfLife,
+		halfLifeTrades:       config.HalfLifeTrades,
+		totalWeightedValues:  new(big.Float),
+		totalWeights:         new(big.Float),
+		totalWeightedSquares: new(big.Float),
+	}
+}
+
+func (e *ewAggregator) Name() string {
+	return "ew_vwap"
+}
+
+// decay returns the factor the current totals are multiplied by before adding point
+func (e *ewAggregator) decay(point *dtos.Match) float64 {
+	factor := 1.0
+	if e.halfLifeTrades > 0 {
+		factor *= math.Pow(0.5, 1/float64(e.halfLifeTrades))
+	}
+	if e.halfLife > 0 && !e.lastTime.IsZero() && point.Time.After(e.lastTime) {
+		factor *= math.Pow(0.5, float64(point.Time.Sub(e.lastTime))/float64(e.halfLife))
+	}
+	return factor
+}
+
+func (e *ewAggregator) Add(point *dtos.Match) {
+	factor := big.NewFloat(e.decay(point))
+	e.totalWeightedValues.Mul(e.totalWeightedValues, factor)
+	e.totalWeights.Mul(e.totalWeights, factor)
+	e.totalWeightedSquares.Mul(e.totalWeightedSquares, factor)
+
+	mul := new(big.Float).Mul(point.Price, point.Size)
+	e.totalWeightedValues.Add(e.totalWeightedValues, mul)
+	e.totalWeights.Add(e.totalWeights, point.Size)
+	e.totalWeightedSquares.Add(e.totalWeightedSquares, weightedSquare(point))
+	if point.Time.After(e.lastTime) {
+		e.lastTime = point.Time
+	}
+}
+
+func (e *ewAggregator) Evict(point *dtos.Match) {}
+
+func (e *ewAggregator) Value() *big.Float {
+	if e.totalWeights.Sign() == 0 {
+		return new(big.Float)
+	}
+	return new(big.Float).Quo(e.totalWeightedValues, e.totalWeights)
+}
+
+func (e *ewAggregator) Variance() *big.Float {
+	return volumeWeightedVariance(e.totalWeightedSquares, e.totalWeightedValues, e.totalWeights)
+}
@@ -0,0 +1,93 @@
+package calculator
+
+import (
+	"fmt"
+	"math/big"
+	"vwap/pkg/dtos"
+)
+
+// TradeFilter rejects erroneous trades before they reach the windows of a product.
+// Deviations are measured against the current vwap, so they only apply once the product has trades.
+type TradeFilter struct {
+	// RejectInvalid rejects trades with zero or negative size or price
+	RejectInvalid bool
+	// MaxDeviation rejects trades whose price deviates more than this fraction from the vwap, e.g. 0.05 for 5%
+	MaxDeviation float64
+	// MaxSigmas rejects trades whose price deviates more than this number of σ from the vwap
+	MaxSigmas float64
+	// MinTrades is the number of trades the primary window has to hold before deviations are checked
+	MinTrades int
+	// ReanchorAfter optionally follows sustained moves, which the vwap would otherwise never reach since
+	// their trades are rejected. Once this many consecutive trades were rejected within MaxDeviation of each
+	// other, the next one is accepted, so the vwap moves in steps until the prices fall within the limits
+	// again. Zero disables it, deviating trades are then always rejected.
+	ReanchorAfter int
+}
+
+// deviates tells whether price deviates more than maxDeviation from reference, never when it's not set
+func deviates(price, reference *big.Float, maxDeviation float64) bool {
+	if maxDeviation <= 0 || reference.Sign() <= 0 {
+		return false
+	}
+	deviation := new(big.Float).Sub(price, reference)
+	deviation.Abs(deviation)
+	return deviation.Cmp(new(big.Float).Mul(reference, big.NewFloat(maxDeviation))) > 0
+}
+
+// invalid returns why the trade can't be accounted at all, or an empty string when it can
+func (f TradeFilter) invalid(point *dtos.Match) string {
+	if point.Price == nil || point.Size == nil {
+		return "missing price or size"
+	}
+	if f.RejectInvalid && (point.Price.Sign() <= 0 || point.Size.Sign() <= 0) {
+		return fmt.Sprintf("invalid price %s or size %s", point.Price.Text('f', -1), point.Size.Text('f', -1))
+	}
+	return ""
+}
+
+// reject returns why the trade has to be rejected, or an empty string when it is accepted
+func (a *AvgData) reject(point *dtos.Match) string {
+	filter := a.config.Filter
+	if reason := filter.invalid(point); reason != "" {
+		return reason
+	}
+	if a.windows[0].count == 0 || a.windows[0].count < filter.MinTrades {
+		return ""
+	}
+	reason := a.deviation(point)
+	if reason == "" || filter.ReanchorAfter <= 0 {
+		a.rejections = 0
+		return reason
+	}
+	// a price that keeps deviating the same way is a move of the market rather than erroneous prints
+	if a.rejections > 0 && deviates(point.Price, a.lastRejected, filter.MaxDeviation) {
+		a.rejections = 0
+	}
+	a.lastRejected = point.Price
+	if a.rejections >= filter.ReanchorAfter {
+		a.rejections = 0
+		return ""
+	}
+	a.rejections++
+	return reason
+}
+
+// deviation returns why the price of the trade deviates too much from the vwap, or an empty string
+func (a *AvgData) deviation(point *dtos.Match) string {
+	filter := a.config.Filter
+	if deviates(point.Price, a.CalculatedVwap, filter.MaxDeviation) {
+		return fmt.Sprintf("price %s deviates more than %g%% from vwap %s",
+			point.Price.Text('f', -1), filter.MaxDeviation*100, a.CalculatedVwap.Text('f', -1))
+	}
+	// a window without dispersion has no meaningful σ, any other price would be rejected
+	stdDev := new(big.Float).Sqrt(a.vwap.Variance())
+	if filter.MaxSigmas > 0 && stdDev.Sign() > 0 {
+		distance := new(big.Float).Sub(point.Price, a.CalculatedVwap)
+		distance.Abs(distance)
+		if distance.Cmp(new(big.Float).Mul(stdDev, big.NewFloat(filter.MaxSigmas))) > 0 {
+			return fmt.Sprintf("price %s deviates more than %gσ from vwap %s",
+				point.Price.Text('f', -1), filter.MaxSigmas, a.CalculatedVwap.Text('f', -1))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,221 @@
+package calculator
+
+import (
+	"math/big"
+	"testing"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoinbaseVWAPCalculator_TradeFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   TradeFilter
+		windows  []Window
+		price    float64
+		size     float64
+		rejected bool
+	}{
+		{
+			name:   "test trade accepted",
+			filter: TradeFilter{RejectInvalid: true, MaxDeviation: 0.1, MaxSigmas: 3},
+			price:  101.0,
+			size:   1.0,
+		},
+		{
+			name:     "test zero size rejected",
+			filter:   TradeFilter{RejectInvalid: true},
+			price:    100.0,
+			size:     0.0,
+			rejected: true,
+		},
+		{
+			name:     "test negative price rejected",
+			filter:   TradeFilter{RejectInvalid: true},
+			price:    -100.0,
+			size:     1.0,
+			rejected: true,
+		},
+		{
+			name:     "test percentage deviation rejected",
+			filter:   TradeFilter{MaxDeviation: 0.1},
+			price:    120.0,
+			size:     1.0,
+			rejected: true,
+		},
+		{
+			name:     "test sigma deviation rejected",
+			filter:   TradeFilter{MaxSigmas: 2},
+			price:    104.0,
+			size:     1.0,
+			rejected: true,
+		},
+		{
+			name:   "test deviation ignored before min trades",
+			filter: TradeFilter{MaxDeviation: 0.1, MinTrades: 10},
+			price:  120.0,
+			size:   1.0,
+		},
+		{
+			name:    "test min trades of the primary window",
+			filter:  TradeFilter{MaxDeviation: 0.1, MinTrades: 2},
+			windows: []Window{{Trades: 1}, {Trades: 10}},
+			price:   120.0,
+			size:    1.0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewCoinbaseCalculator(0, WithDefaultProductConfig(ProductConfig{Filter: tt.filter, Windows: tt.windows}))
+			// vwap 100 and σ 1
+			for _, price := range []float64{99.0, 101.0} {
+				c.calcAvg(&dtos.Match{
+					ProductId: "BTC-USD",
+					Type:      "match",
+					Price:     big.NewFloat(price),
+					Size:      big.NewFloat(1.0),
+				})
+			}
+			trade := &dtos.Match{
+				ProductId: "BTC-USD",
+				Type:      "match",
+				Price:     big.NewFloat(tt.price),
+				Size:      big.NewFloat(tt.size),
+			}
+			c.calcAvg(trade)
+			if !tt.rejected {
+				assert.Len(t, c.productAvgs["BTC-USD"].points, 3)
+				assert.Empty(t, c.Events())
+				return
+			}
+			assert.Len(t, c.productAvgs["BTC-USD"].points, 2)
+			event := <-c.Events()
+			assert.Equal(t, dtos.TradeRejectedEvent, event.Type)
+			assert.Equal(t, "BTC-USD", event.ProductId)
+			assert.Equal(t, trade, event.Trade)
+			assert.NotEmpty(t, event.Message)
+		})
+	}
+}
+
+func TestCoinbaseVWAPCalculator_TradeFilterMove(t *testing.T) {
+	const reanchorAfter = 10
+	repeat := func(price float64, n int) []float64 {
+		prices := make([]float64, n)
+		for i := range prices {
+			prices[i] = price
+		}
+		return prices
+	}
+	tests := []struct {
+		name          string
+		reanchorAfter int
+		// prices are traded after 50 trades at 100
+		prices       []float64
+		wantRejected int
+		wantVwap     float64
+	}{
+		{
+			name:         "test sustained move rejected without reanchoring",
+			prices:       repeat(90.0, 1000),
+			wantRejected: 1000,
+			wantVwap:     100.0,
+		},
+		{
+			name:          "test sustained move followed when reanchoring",
+			reanchorAfter: reanchorAfter,
+			prices:        repeat(90.0, 1000),
+			// every eleventh trade is accepted until the vwap is within 5% of 90
+			wantRejected: 560,
+			wantVwap:     90.0,
+		},
+		{
+			name:          "test isolated outliers rejected when reanchoring",
+			reanchorAfter: reanchorAfter,
+			prices:        append(repeat(150.0, reanchorAfter), 100.0, 150.0),
+			wantRejected:  reanchorAfter + 1,
+			wantVwap:      100.0,
+		},
+		{
+			name:          "test inconsistent outliers rejected when reanchoring",
+			reanchorAfter: reanchorAfter,
+			prices: func() []float64 {
+				var prices []float64
+				for i := 0; i < reanchorAfter; i++ {
+					prices = append(prices, 50.0, 150.0)
+				}
+				return prices
+			}(),
+			wantRejected: 2 * reanchorAfter,
+			wantVwap:     100.0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewCoinbaseCalculator(0, WithDefaultProductConfig(ProductConfig{
+				Filter: TradeFilter{RejectInvalid: true, MaxDeviation: 0.05, MinTrades: 20, ReanchorAfter: tt.reanchorAfter},
+			}))
+			var rejected int
+			for _, price := range append(repeat(100.0, 50), tt.prices...) {
+				c.calcAvg(&dtos.Match{
+					ProductId: "BTC-USD",
+					Type:      "match",
+					Price:     big.NewFloat(price),
+					Size:      big.NewFloat(1.0),
+				})
+				// drains the events as they come, there are more rejections than the channel holds
+				select {
+				case <-c.Events():
+					rejected++
+				default:
+				}
+			}
+			assert.Equal(t, tt.wantRejected, rejected)
+			vwap, _ := c.productAvgs["BTC-USD"].CalculatedVwap.Float64()
+			assert.InDelta(t, tt.wantVwap, vwap, 1e-9)
+		})
+	}
+}
+
+func TestCoinbaseVWAPCalculator_TradeFilterSequenceGaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		tradeIds []int64
+		wantGaps float64
+	}{
+		{
+			name:     "test rejected trade is no gap",
+			tradeIds: []int64{1, 2, 3},
+		},
+		{
+			name:     "test gap after a rejected trade",
+			tradeIds: []int64{1, 2, 5},
+			wantGaps: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := NewCoinbaseCalculator(0, WithDefaultProductConfig(ProductConfig{
+				Filter: TradeFilter{RejectInvalid: true},
+			}))
+			gaps := sequenceGaps.WithLabelValues("GAP-USD").Value()
+			for i, tradeId := range tt.tradeIds {
+				price := 100.0
+				// the second trade is rejected
+				if i == 1 {
+					price = 0
+				}
+				c.calcAvg(&dtos.Match{
+					ProductId: "GAP-USD",
+					Type:      "match",
+					TradeId:   tradeId,
+					Price:     big.NewFloat(price),
+					Size:      big.NewFloat(1.0),
+				})
+			}
+			assert.Len(t, c.Events(), 1)
+			assert.Equal(t, gaps+tt.wantGaps, sequenceGaps.WithLabelValues("GAP-USD").Value())
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package calculator
+
+import "vwap/pkg/metrics"
+
+var (
+	tradesProcessed = metrics.NewCounterVec("vwap_calculator_trades_total",
+		"Trades accounted by the calculator by product.", "product_id")
+	sequenceGaps = metrics.NewCounterVec("vwap_calculator_sequence_gaps_total",
+		"Gaps in the consecutive trade ids of a product, i.e. missed trades.", "product_id")
+	calculatorLag = metrics.NewGaugeVec("vwap_calculator_lag_seconds",
+		"Time between the last trade of a product and its calculation.", "product_id")
+	emissions = metrics.NewCounter("vwap_calculator_emissions_total",
+		"Product averages emitted by the calculator.")
+	queueDepth = metrics.NewGaugeVec("vwap_calculator_queue_depth",
+		"Messages waiting on the output channels of the calculator.", "channel")
+)
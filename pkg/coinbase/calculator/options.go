@@ -0,0 +1,78 @@
+package calculator
+
+import "time"
+
+// Option configures optional behaviour of the CoinbaseVWAPCalculator
+type Option func(*CoinbaseVWAPCalculator)
+
+// WithSnapshot persists the calculator state to path every interval and when the calculator stops.
+// An existing snapshot at path is restored when the calculator is created, dropping the trades
+// older than the windows of their product.
+func WithSnapshot(path string, interval time.Duration) Option {
+	return func(c *CoinbaseVWAPCalculator) {
+		c.snapshotPath = path
+		c.snapshotInterval = interval
+	}
+}
+
+// WithDefaultProductConfig sets the configuration used by products without a specific one
+func WithDefaultProductConfig(config ProductConfig) Option {
+	return func(c *CoinbaseVWAPCalculator) {
+		c.defaultConfig = config
+	}
+}
+
+// WithProductConfig sets the configuration of a single product
+func WithProductConfig(productId string, config ProductConfig) Option {
+	return func(c *CoinbaseVWAPCalculator) {
+		c.productConfigs[productId] = config
+	}
+}
+
+// WithBands emits the vwap ± k·σ bands of every product for each given k, e.g. 1, 2 and 3
+func WithBands(ks ...float64) Option {
+	return func(c *CoinbaseVWAPCalculator) {
+		c.bands = ks
+	}
+}
+
+// WithCandles builds OHLCV bars of every given interval, e.g. 1s, 1m and 5m, sent on the Candles channel
+// which must then be drained
+func WithCandles(intervals ...time.Duration) Option {
+	return func(c *CoinbaseVWAPCalculator) {
+		for _, interval := range intervals {
+			c.candleBuilders = append(c.candleBuilders, NewCandleBuilder(interval))
+		}
+	}
+}
+
+// WithTriangles compares the vwap of every product with the cross rates derived from the other products
+func WithTriangles() Option {
+	return func(c *CoinbaseVWAPCalculator) {
+		c.triangles = true
+	}
+}
+
+// WithOrderBook maintains the level2 order book of every product, emitting the top depth levels of
+// each side along with the mid, the microprice and the deviation of the vwap from the mid
+func WithOrderBook(depth int) Option {
+	return func(c *CoinbaseVWAPCalculator) {
+		c.bookDepth = depth
+	}
+}
+
+// WithOwnFills computes the vwap of our own fills, the trades marked with our user on authenticated
+// feeds, in parallel with the market vwap
+func WithOwnFills() Option {
+	return func(c *CoinbaseVWAPCalculator) {
+		c.ownFills = make(map[string]*AvgData)
+	}
+}
+
+// WithDeltaUpdates only emits the products whose vwap changed since the last emission,
+// along with a full emission of every product once per fullInterval
+func WithDeltaUpdates(fullInterval time.Duration) Option {
+	return func(c *CoinbaseVWAPCalculator) {
+		c.deltaFullInterval = fullInterval
+	}
+}
@@ -0,0 +1,224 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"vwap/pkg/dtos"
+)
+
+const (
+	snapshotType = "snapshot"
+	l2updateType = "l2update"
+	buySide      = "buy"
+	sellSide     = "sell"
+)
+
+// bookLevel is a price level of one side of the book
+type bookLevel struct {
+	price *big.Float
+	size  *big.Float
+}
+
+// bookSide keeps the levels of one side of the book sorted from the best price,
+// descending for bids and ascending for asks
+type bookSide struct {
+	levels     []bookLevel
+	descending bool
+}
+
+// set replaces the size of the level at price, a zero size removes it
+func (s *bookSide) set(price, size *big.Float) {
+	i := sort.Search(len(s.levels), func(i int) bool {
+		cmp := s.levels[i].price.Cmp(price)
+		if s.descending {
+			return cmp <= 0
+		}
+		return cmp >= 0
+	})
+	if i < len(s.levels) && s.levels[i].price.Cmp(price) == 0 {
+		if size.Sign() == 0 {
+			s.levels = append(s.levels[:i], s.levels[i+1:]...)
+			return
+		}
+		s.levels[i].size = size
+		return
+	}
+	if size.Sign() == 0 {
+		return
+	}
+	s.levels = append(s.levels, bookLevel{})
+	copy(s.levels[i+1:], s.levels[i:])
+	s.levels[i] = bookLevel{price: price, size: size}
+}
+
+func (s *bookSide) best() (bookLevel, bool) {
+	if len(s.levels) == 0 {
+		return bookLevel{}, false
+	}
+	return s.levels[0], true
+}
+
+// top returns up to n levels from the best price
+func (s *bookSide) top(n int) []dtos.BookLevel {
+	if n > len(s.levels) {
+		n = len(s.levels)
+	}
+	levels := make([]dtos.BookLevel, n)
+	for i, level := range s.levels[:n] {
+		levels[i] = dtos.BookLevel{
+			Price: dtos.NewDecimal(level.price),
+			Size:  dtos.NewDecimal(level.size),
+		}
+	}
+	return levels
+}
+
+// OrderBook maintains the level2 order book of a product from its snapshot and the later updates.
+// The book is only synced between a snapshot and the first update that leaves it inconsistent.
+type OrderBook struct {
+	bids   bookSide
+	asks   bookSide
+	synced bool
+}
+
+// NewOrderBook creates an empty book, waiting for its snapshot
+func NewOrderBook() *OrderBook {
+	b := &OrderBook{}
+	b.Reset()
+	return b
+}
+
+// Reset empties the book, it waits for a new snapshot afterwards
+func (b *OrderBook) Reset() {
+	b.bids = bookSide{descending: true}
+	b.asks = bookSide{}
+	b.synced = false
+}
+
+// Synced reports whether the book was built from a snapshot and is consistent since
+func (b *OrderBook) Synced() bool {
+	return b.synced
+}
+
+// Apply applies a snapshot or an update to the book. On error the book is reset, since it can no
+// longer be trusted until the next snapshot.
+func (b *OrderBook) Apply(msg *dtos.Level2) error {
+	err := b.apply(msg)
+	if err != nil {
+		b.Reset()
+	}
+	return err
+}
+
+func (b *OrderBook) apply(msg *dtos.Level2) error {
+	switch msg.Type {
+	case snapshotType:
+		b.Reset()
+		for _, level := range msg.Bids {
+			if err := b.set(&b.bids, level[0], level[1]); err != nil {
+				return err
+			}
+		}
+		for _, level := range msg.Asks {
+			if err := b.set(&b.asks, level[0], level[1]); err != nil {
+				return err
+			}
+		}
+		b.synced = true
+	case l2updateType:
+		if !b.synced {
+			return errors.New("update received before the snapshot")
+		}
+		for _, change := range msg.Changes {
+			var side *bookSide
+			switch change[0] {
+			case buySide:
+				side = &b.bids
+			case sellSide:
+				side = &b.asks
+			default:
+				return fmt.Errorf("unknown side %q", change[0])
+			}
+			if err := b.set(side, change[1], change[2]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown level2 message %q", msg.Type)
+	}
+	return b.verify()
+}
+
+func (b *OrderBook) set(side *bookSide, price, size string) error {
+	p, _, err := big.ParseFloat(price, 10, 0, big.ToNearestEven)
+	if err != nil || p.Sign() <= 0 {
+		return fmt.Errorf("invalid price %q", price)
+	}
+	s, _, err := big.ParseFloat(size, 10, 0, big.ToNearestEven)
+	if err != nil || s.Sign() < 0 {
+		return fmt.Errorf("invalid size %q", size)
+	}
+	side.set(p, s)
+	return nil
+}
+
+// verify checks the book is not crossed, i.e. the best bid is below the best ask
+func (b *OrderBook) verify() error {
+	bid, okBid := b.bids.best()
+	ask, okAsk := b.asks.best()
+	if okBid && okAsk && bid.price.Cmp(ask.price) >= 0 {
+		return fmt.Errorf("crossed book, best bid %s is not below best ask %s",
+			bid.price.Text('f', -1), ask.price.Text('f', -1))
+	}
+	return nil
+}
+
+// Depth returns up to n levels of each side, from the best price
+func (b *OrderBook) Depth(n int) (bids, asks []dtos.BookLevel) {
+	return b.bids.top(n), b.asks.top(n)
+}
+
+// Mid returns the average of the best bid and ask, nil when a side is empty
+func (b *OrderBook) Mid() *big.Float {
+	bid, okBid := b.bids.best()
+	ask, okAsk := b.asks.best()
+	if !okBid || !okAsk {
+		return nil
+	}
+	mid := new(big.Float).Add(bid.price, ask.price)
+	return mid.Quo(mid, big.NewFloat(2))
+}
+
+// Microprice returns the mid weighted by the size on the opposite side,
+// (bid·askSize + ask·bidSize) / (bidSize + askSize), nil when a side is empty
+func (b *OrderBook) Microprice() *big.Float {
+	bid, okBid := b.bids.best()
+	ask, okAsk := b.asks.best()
+	if !okBid || !okAsk {
+		return nil
+	}
+	micro := new(big.Float).Mul(bid.price, ask.size)
+	micro.Add(micro, new(big.Float).Mul(ask.price, bid.size))
+	return micro.Quo(micro, new(big.Float).Add(bid.size, ask.size))
+}
+
+// summary returns the top n levels of the book along with the deviation of the vwap from the mid,
+// false when the book is not synced or a side is empty
+func (b *OrderBook) summary(n int, vwap *big.Float) (dtos.Book, bool) {
+	mid := b.Mid()
+	if !b.synced || mid == nil {
+		return dtos.Book{}, false
+	}
+	bids, asks := b.Depth(n)
+	deviation := new(big.Float).Sub(vwap, mid)
+	deviation.Quo(deviation, mid)
+	return dtos.Book{
+		Bids:             bids,
+		Asks:             asks,
+		Mid:              dtos.NewDecimal(mid),
+		Microprice:       dtos.NewDecimal(b.Microprice()),
+		VwapMidDeviation: dtos.NewDecimal(deviation),
+	}, true
+}
@@ -0,0 +1,108 @@
+package calculator
+
+import (
+	"testing"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderBook_Apply(t *testing.T) {
+	snapshot := &dtos.Level2{
+		Type: "snapshot",
+		Bids: [][2]string{{"99", "2"}, {"100", "1"}, {"98", "5"}},
+		Asks: [][2]string{{"102", "4"}, {"101", "3"}},
+	}
+	tests := []struct {
+		name       string
+		msgs       []*dtos.Level2
+		wantErr    bool
+		wantSynced bool
+		wantBids   []dtos.BookLevel
+		wantAsks   []dtos.BookLevel
+		wantMid    dtos.Decimal
+		wantMicro  dtos.Decimal
+	}{
+		{
+			name:       "test snapshot",
+			msgs:       []*dtos.Level2{snapshot},
+			wantSynced: true,
+			wantBids:   []dtos.BookLevel{{Price: "100", Size: "1"}, {Price: "99", Size: "2"}},
+			wantAsks:   []dtos.BookLevel{{Price: "101", Size: "3"}, {Price: "102", Size: "4"}},
+			wantMid:    "100.5",
+			// (100·3 + 101·1) / (1 + 3)
+			wantMicro: "100.25",
+		},
+		{
+			name: "test updates change, add and remove levels",
+			msgs: []*dtos.Level2{snapshot, {
+				Type:    "l2update",
+				Changes: [][3]string{{"buy", "100", "0"}, {"buy", "99.5", "1"}, {"sell", "101", "1"}, {"sell", "100.5", "3"}},
+			}},
+			wantSynced: true,
+			wantBids:   []dtos.BookLevel{{Price: "99.5", Size: "1"}, {Price: "99", Size: "2"}},
+			wantAsks:   []dtos.BookLevel{{Price: "100.5", Size: "3"}, {Price: "101", Size: "1"}},
+			wantMid:    "100",
+			// (99.5·3 + 100.5·1) / (1 + 3)
+			wantMicro: "99.75",
+		},
+		{
+			name:     "test update before snapshot",
+			msgs:     []*dtos.Level2{{Type: "l2update", Changes: [][3]string{{"buy", "100", "1"}}}},
+			wantErr:  true,
+			wantBids: []dtos.BookLevel{},
+			wantAsks: []dtos.BookLevel{},
+		},
+		{
+			name: "test crossed book",
+			msgs: []*dtos.Level2{snapshot, {
+				Type:    "l2update",
+				Changes: [][3]string{{"buy", "101", "1"}},
+			}},
+			wantErr:  true,
+			wantBids: []dtos.BookLevel{},
+			wantAsks: []dtos.BookLevel{},
+		},
+		{
+			name: "test invalid change",
+			msgs: []*dtos.Level2{snapshot, {
+				Type:    "l2update",
+				Changes: [][3]string{{"buy", "abc", "1"}},
+			}},
+			wantErr:  true,
+			wantBids: []dtos.BookLevel{},
+			wantAsks: []dtos.BookLevel{},
+		},
+		{
+			name: "test snapshot after an inconsistency resyncs",
+			msgs: []*dtos.Level2{snapshot, {
+				Type:    "l2update",
+				Changes: [][3]string{{"sell", "99", "1"}},
+			}, snapshot},
+			wantErr:    true,
+			wantSynced: true,
+			wantBids:   []dtos.BookLevel{{Price: "100", Size: "1"}, {Price: "99", Size: "2"}},
+			wantAsks:   []dtos.BookLevel{{Price: "101", Size: "3"}, {Price: "102", Size: "4"}},
+			wantMid:    "100.5",
+			wantMicro:  "100.25",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook()
+			var err error
+			for _, msg := range tt.msgs {
+				if applyErr := book.Apply(msg); applyErr != nil {
+					err = applyErr
+				}
+			}
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantSynced, book.Synced())
+			bids, asks := book.Depth(2)
+			assert.Equal(t, tt.wantBids, bids)
+			assert.Equal(t, tt.wantAsks, asks)
+			assert.Equal(t, tt.wantMid, dtos.NewDecimal(book.Mid()))
+			assert.Equal(t, tt.wantMicro, dtos.NewDecimal(book.Microprice()))
+		})
+	}
+}
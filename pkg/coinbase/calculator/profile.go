@@ -0,0 +1,125 @@
+package calculator
+
+import (
+	"math/big"
+	"sort"
+	"vwap/pkg/dtos"
+)
+
+// valueAreaShare is the share of the window volume the value area holds
+const valueAreaShare = 0.7
+
+// profileBucket is the volume traded within a single price bucket
+type profileBucket struct {
+	volume *big.Float
+	// trades counts the trades in the bucket so it is dropped exactly when its last trade leaves
+	trades int
+}
+
+// volumeProfile is the volume at price histogram of a window, buckets are updated
+// as trades are added and evicted, the point of control and value area on emission
+type volumeProfile struct {
+	bucketWidth *big.Float
+	buckets     map[int64]*profileBucket
+	totalVolume *big.Float
+}
+
+func newVolumeProfile(bucketWidth float64) *volumeProfile {
+	return &volumeProfile{
+		bucketWidth: big.NewFloat(bucketWidth),
+		buckets:     make(map[int64]*profileBucket),
+		totalVolume: new(big.Float),
+	}
+}
+
+// bucketOf returns the index of the bucket holding price, floor(price / bucketWidth)
+func (v *volumeProfile) bucketOf(price *big.Float) int64 {
+	index, accuracy := new(big.Float).Quo(price, v.bucketWidth).Int64()
+	if accuracy == big.Above {
+		index--
+	}
+	return index
+}
+
+func (v *volumeProfile) Add(point *dtos.Match) {
+	index := v.bucketOf(point.Price)
+	bucket, ok := v.buckets[index]
+	if !ok {
+		bucket = &profileBucket{volume: new(big.Float)}
+		v.buckets[index] = bucket
+	}
+	bucket.volume.Add(bucket.volume, point.Size)
+	bucket.trades++
+	v.totalVolume.Add(v.totalVolume, point.Size)
+}
+
+func (v *volumeProfile) Evict(point *dtos.Match) {
+	index := v.bucketOf(point.Price)
+	bucket, ok := v.buckets[index]
+	if !ok {
+		return
+	}
+	bucket.volume.Sub(bucket.volume, point.Size)
+	bucket.trades--
+	if bucket.trades == 0 {
+		delete(v.buckets, index)
+	}
+	v.totalVolume.Sub(v.totalVolume, point.Size)
+}
+
+// priceOf returns the lower bound of the bucket
+func (v *volumeProfile) priceOf(index int64) *big.Float {
+	return new(big.Float).Mul(new(big.Float).SetInt64(index), v.bucketWidth)
+}
+
+// result converts the histogram into its emitted form. The value area grows from the point
+// of control towards the adjacent bucket with the higher volume until it holds valueAreaShare.
+func (v *volumeProfile) result() dtos.VolumeProfile {
+	result := dtos.VolumeProfile{
+		BucketWidth: dtos.NewDecimal(v.bucketWidth),
+	}
+	if len(v.buckets) == 0 {
+		return result
+	}
+	indexes := make([]int64, 0, len(v.buckets))
+	for index := range v.buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	poc := 0
+	for i, index := range indexes {
+		volume := v.buckets[index].volume
+		result.Levels = append(result.Levels, dtos.PriceLevel{
+			Price:  dtos.NewDecimal(v.priceOf(index)),
+			Volume: dtos.NewDecimal(volume),
+		})
+		if volume.Cmp(v.buckets[indexes[poc]].volume) > 0 {
+			poc = i
+		}
+	}
+
+	target := new(big.Float).Mul(v.totalVolume, big.NewFloat(valueAreaShare))
+	area := new(big.Float).Set(v.buckets[indexes[poc]].volume)
+	low, high := poc, poc
+	for area.Cmp(target) < 0 && (low > 0 || high < len(indexes)-1) {
+		switch {
+		case low == 0:
+			high++
+			area.Add(area, v.buckets[indexes[high]].volume)
+		case high == len(indexes)-1:
+			low--
+			area.Add(area, v.buckets[indexes[low]].volume)
+		case v.buckets[indexes[high+1]].volume.Cmp(v.buckets[indexes[low-1]].volume) >= 0:
+			high++
+			area.Add(area, v.buckets[indexes[high]].volume)
+		default:
+			low--
+			area.Add(area, v.buckets[indexes[low]].volume)
+		}
+	}
+	result.PointOfControl = dtos.NewDecimal(v.priceOf(indexes[poc]))
+	result.ValueAreaLow = dtos.NewDecimal(v.priceOf(indexes[low]))
+	result.ValueAreaHigh = dtos.NewDecimal(new(big.Float).Add(v.priceOf(indexes[high]), v.bucketWidth))
+	return result
+}
@@ -0,0 +1,66 @@
+package calculator
+
+import (
+	"math/big"
+	"testing"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeProfile(t *testing.T) {
+	trade := func(price, size float64) *dtos.Match {
+		return &dtos.Match{
+			Price: big.NewFloat(price),
+			Size:  big.NewFloat(size),
+		}
+	}
+	tests := []struct {
+		name   string
+		evict  []*dtos.Match
+		levels int
+		poc    float64
+		vaLow  float64
+		vaHigh float64
+	}{
+		{
+			name:   "test point of control and value area",
+			levels: 4,
+			poc:    100.0,
+			vaLow:  100.0,
+			vaHigh: 120.0,
+		},
+		{
+			name:   "test evicted trades leave their bucket",
+			evict:  []*dtos.Match{trade(105.0, 3.0), trade(101.0, 1.0)},
+			levels: 3,
+			poc:    110.0,
+			vaLow:  110.0,
+			vaHigh: 130.0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newVolumeProfile(10.0)
+			for _, point := range []*dtos.Match{trade(101.0, 1.0), trade(105.0, 3.0), trade(112.0, 2.0), trade(125.0, 1.0), trade(95.0, 1.0)} {
+				v.Add(point)
+			}
+			for _, point := range tt.evict {
+				v.Evict(point)
+			}
+			result := v.result()
+			assert.Len(t, result.Levels, tt.levels)
+			for _, want := range []struct {
+				got  dtos.Decimal
+				want float64
+			}{
+				{got: result.PointOfControl, want: tt.poc},
+				{got: result.ValueAreaLow, want: tt.vaLow},
+				{got: result.ValueAreaHigh, want: tt.vaHigh},
+			} {
+				value := want.got.Float64()
+				assert.Equal(t, want.want, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package calculator
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCoinbaseVWAPCalculator_ConcurrentConsumers reads every emission while trades keep being
+// ingested, it is meant to run with the race detector: go test -race ./...
+func TestCoinbaseVWAPCalculator_ConcurrentConsumers(t *testing.T) {
+	const trades = 150
+	productIds := []string{"BTC-USD", "ETH-USD", "ETH-BTC"}
+	start := time.Date(2021, 10, 7, 10, 0, 0, 0, time.UTC)
+	c, _ := NewCoinbaseCalculator(0,
+		WithBands(1, 2),
+		WithTriangles(),
+		WithCandles(time.Second),
+		WithDefaultProductConfig(ProductConfig{
+			Windows:            []Window{{Trades: 20}, {Duration: 5 * time.Second}},
+			Aggregators:        []AggregatorFactory{NewTWAPAggregator, NewSMAAggregator, NewMedianAggregator},
+			ProfileBucketWidth: 1,
+			Filter:             TradeFilter{RejectInvalid: true, MaxDeviation: 0.5},
+		}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	responseChan := make(chan dtos.Message)
+	productAvgs, err := c.CalcAvg(ctx, responseChan)
+	assert.NoError(t, err)
+
+	var consumers sync.WaitGroup
+	consume := func(value interface{}) {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			_, err := json.Marshal(value)
+			assert.NoError(t, err)
+		}()
+	}
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case emission := <-productAvgs:
+				consume(emission)
+				for _, vwap := range emission.Products {
+					assert.NotNil(t, vwap.Float())
+				}
+			case candle := <-c.Candles():
+				consume(candle)
+			case event := <-c.Events():
+				consume(event)
+			}
+		}
+	}()
+	for i := 0; i < trades; i++ {
+		price := 100.0 + float64(i%10)
+		if i%50 == 0 {
+			price = 0
+		}
+		responseChan <- &dtos.Match{
+			ProductId: productIds[i%len(productIds)],
+			Type:      "match",
+			Sequence:  int64(i + 1),
+			Time:      start.Add(time.Duration(i) * 100 * time.Millisecond),
+			Price:     big.NewFloat(price),
+			Size:      big.NewFloat(1.0),
+		}
+	}
+	cancel()
+	<-readerDone
+	consumers.Wait()
+}
@@ -0,0 +1,82 @@
+package calculator
+
+import (
+	"sort"
+	"time"
+)
+
+// sessionTimer fires at the end of the earliest anchored session, so sessions close at their
+// anchor even when no trade arrives afterwards
+type sessionTimer struct {
+	timer *time.Timer
+	end   time.Time
+}
+
+// arm sets the timer to fire at end, a zero end stops it
+func (s *sessionTimer) arm(end time.Time) {
+	if end.Equal(s.end) {
+		return
+	}
+	s.stop()
+	s.end = end
+	if !end.IsZero() {
+		s.timer = time.NewTimer(time.Until(end))
+	}
+}
+
+// fired forgets the end the timer fired for, so the next arm sets it again even for the same end
+func (s *sessionTimer) fired() {
+	s.timer = nil
+	s.end = time.Time{}
+}
+
+func (s *sessionTimer) stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// C returns the channel the timer fires on, nil when it's not armed
+func (s *sessionTimer) C() <-chan time.Time {
+	if s.timer == nil {
+		return nil
+	}
+	return s.timer.C
+}
+
+// sessionEnd returns the end of the current session of an anchored product, zero otherwise
+func (a *AvgData) sessionEnd() time.Time {
+	if a.config.Mode != AnchoredMode || a.sessionStart.IsZero() {
+		return time.Time{}
+	}
+	return a.sessionStart.Add(a.config.sessionLength())
+}
+
+// nextSessionEnd returns the earliest end of the sessions of every anchored product, zero without any
+func (c *CoinbaseVWAPCalculator) nextSessionEnd() time.Time {
+	var next time.Time
+	for _, avgdata := range c.productAvgs {
+		end := avgdata.sessionEnd()
+		if !end.IsZero() && (next.IsZero() || end.Before(next)) {
+			next = end
+		}
+	}
+	return next
+}
+
+// closeSessions closes the anchored sessions that ended by now, including the ones of products
+// that had no trade since
+func (c *CoinbaseVWAPCalculator) closeSessions(now time.Time) {
+	var productIds []string
+	for productId := range c.productAvgs {
+		productIds = append(productIds, productId)
+	}
+	sort.Strings(productIds)
+	for _, productId := range productIds {
+		if closed := c.productAvgs[productId].rollSession(now); closed != nil {
+			closed.ProductId = productId
+			c.sessionCloses = append(c.sessionCloses, *closed)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package calculator
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+	"vwap/pkg/dtos"
+)
+
+// snapshot is the on-disk representation of the calculator state
+type snapshot struct {
+	SavedAt  time.Time                   `json:"saved_at"`
+	Products map[string]*productSnapshot `json:"products"`
+}
+
+type productSnapshot struct {
+	Points       []*dtos.Match `json:"points"`
+	LastSequence int64         `json:"last_sequence"`
+	// Totals are the exponentially weighted or anchored totals, which span more trades than the points
+	Totals *totalsSnapshot `json:"totals,omitempty"`
+}
+
+type totalsSnapshot struct {
+	Mode                 Mode       `json:"mode"`
+	TotalWeightedValues  *big.Float `json:"total_weighted_values"`
+	TotalWeights         *big.Float `json:"total_weights"`
+	TotalWeightedSquares *big.Float `json:"total_weighted_squares"`
+	// LastTime is the trade time the exponentially weighted totals were last decayed to
+	LastTime time.Time `json:"last_time,omitempty"`
+	// SessionStart is the start of the session the anchored totals belong to
+	SessionStart time.Time `json:"session_start,omitempty"`
+}
+
+// snapshotTotals copies the totals of the exponentially weighted or anchored vwap, nil in sliding window mode
+func (a *AvgData) snapshotTotals() *totalsSnapshot {
+	switch v := a.vwap.(type) {
+	case *ewAggregator:
+		return &totalsSnapshot{
+			Mode:                 ExponentialMode,
+			TotalWeightedValues:  new(big.Float).Set(v.totalWeightedValues),
+			TotalWeights:         new(big.Float).Set(v.totalWeights),
+			TotalWeightedSquares: new(big.Float).Set(v.totalWeightedSquares),
+			LastTime:             v.lastTime,
+		}
+	case *anchoredAggregator:
+		return &totalsSnapshot{
+			Mode:                 AnchoredMode,
+			TotalWeightedValues:  new(big.Float).Set(v.totalWeightedValues),
+			TotalWeights:         new(big.Float).Set(v.totalWeights),
+			TotalWeightedSquares: new(big.Float).Set(v.totalWeightedSquares),
+			SessionStart:         a.sessionStart,
+		}
+	}
+	return nil
+}
+
+// restoreTotals replaces the exponentially weighted or anchored vwap by the stored totals,
+// which are ignored when they were not taken in the mode of the product anymore
+func (a *AvgData) restoreTotals(t *totalsSnapshot) bool {
+	if t == nil || t.Mode != a.config.Mode ||
+		t.TotalWeightedValues == nil || t.TotalWeights == nil || t.TotalWeightedSquares == nil {
+		return false
+	}
+	switch t.Mode {
+	case ExponentialMode:
+		e := newEWAggregator(a.config)
+		e.totalWeightedValues.Set(t.TotalWeightedValues)
+		e.totalWeights.Set(t.TotalWeights)
+		e.totalWeightedSquares.Set(t.TotalWeightedSquares)
+		e.lastTime = t.LastTime
+		a.vwap = e
+	case AnchoredMode:
+		if t.SessionStart.IsZero() {
+			return false
+		}
+		anchored := newAnchoredAggregator()
+		anchored.totalWeightedValues.Set(t.TotalWeightedValues)
+		anchored.totalWeights.Set(t.TotalWeights)
+		anchored.totalWeightedSquares.Set(t.TotalWeightedSquares)
+		a.vwap = anchored
+		a.sessionStart = t.SessionStart
+	default:
+		return false
+	}
+	a.CalculatedVwap = a.vwap.Value()
+	return true
+}
+
+// takeSnapshot copies the current state of every product
+func (c *CoinbaseVWAPCalculator) takeSnapshot() *snapshot {
+	s := &snapshot{
+		SavedAt:  time.Now().UTC(),
+		Products: make(map[string]*productSnapshot, len(c.productAvgs)),
+	}
+	for k, v := range c.productAvgs {
+		s.Products[k] = &productSnapshot{
+			Points:       append([]*dtos.Match(nil), v.window()...),
+			LastSequence: v.lastSequence,
+			Totals:       v.snapshotTotals(),
+		}
+	}
+	return s
+}
+
+// persist writes the snapshot atomically so a crash never leaves a truncated file behind
+func (c *CoinbaseVWAPCalculator) persist() {
+	if c.snapshotPath == "" {
+		return
+	}
+	if err := writeSnapshot(c.snapshotPath, c.takeSnapshot()); err != nil {
+		log.Printf("unable to write snapshot: %v", err)
+	}
+}
+
+func writeSnapshot(path string, s *snapshot) error {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readSnapshot(path string) (*snapshot, error) {
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshot{}
+	if err := json.Unmarshal(payload, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// restore loads the snapshot, if any, replaying the points that still belong to the windows of their product.
+// Windows are rebuilt from the replayed points since stale ones may have been dropped, while exponentially
+// weighted and anchored products take their stored totals back. An anchored session that ended meanwhile
+// is closed as soon as the calculation starts.
+func (c *CoinbaseVWAPCalculator) restore() {
+	if c.snapshotPath == "" {
+		return
+	}
+	s, err := readSnapshot(c.snapshotPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("unable to restore snapshot: %v", err)
+		}
+		return
+	}
+	now := time.Now()
+	for productId, p := range s.Products {
+		config := c.configFor(productId)
+		var oldest time.Time
+		if retention := config.retention(); retention > 0 {
+			oldest = now.Add(-retention)
+		}
+		avgdata := newAvgData(config)
+		for _, point := range p.Points {
+			if point == nil || point.Price == nil || point.Size == nil || point.Time.Before(oldest) {
+				continue
+			}
+			avgdata.rollSession(point.Time)
+			avgdata.Add(point)
+		}
+		if !avgdata.restoreTotals(p.Totals) && len(avgdata.points) == 0 {
+			continue
+		}
+		avgdata.lastSequence = p.LastSequence
+		c.productAvgs[productId] = avgdata
+	}
+}
@@ -0,0 +1,82 @@
+package calculator
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"vwap/pkg/dtos"
+)
+
+// basisPoints is the number of basis points in a unit
+const basisPoints = 10000
+
+// pair is the base and quote currencies of a product, e.g. ETH and BTC for ETH-BTC
+type pair struct {
+	base  string
+	quote string
+}
+
+func parsePair(productId string) (pair, bool) {
+	currencies := strings.Split(productId, "-")
+	if len(currencies) != 2 || currencies[0] == "" || currencies[1] == "" {
+		return pair{}, false
+	}
+	return pair{base: currencies[0], quote: currencies[1]}, true
+}
+
+// rates returns the price of a currency in another one, from the vwap of the products
+// in either direction, e.g. rates[ETH][USD] from ETH-USD and rates[USD][ETH] from its inverse
+func rates(vwaps map[string]*big.Float) map[string]map[string]*big.Float {
+	rates := make(map[string]map[string]*big.Float)
+	set := func(from, to string, rate *big.Float) {
+		if _, ok := rates[from]; !ok {
+			rates[from] = make(map[string]*big.Float)
+		}
+		rates[from][to] = rate
+	}
+	for productId, vwap := range vwaps {
+		p, ok := parsePair(productId)
+		if !ok || vwap == nil || vwap.Sign() <= 0 {
+			continue
+		}
+		set(p.base, p.quote, vwap)
+		set(p.quote, p.base, new(big.Float).Quo(big.NewFloat(1), vwap))
+	}
+	return rates
+}
+
+// triangles compares the vwap of every product with the cross rate derived through every other
+// currency both its base and quote are traded against, e.g. ETH-BTC against ETH-USD / BTC-USD
+func triangles(vwaps map[string]*big.Float) []dtos.Triangle {
+	rates := rates(vwaps)
+	var result []dtos.Triangle
+	for productId, direct := range vwaps {
+		p, ok := parsePair(productId)
+		if !ok || direct == nil || direct.Sign() <= 0 {
+			continue
+		}
+		for via, baseRate := range rates[p.base] {
+			quoteRate, ok := rates[p.quote][via]
+			if via == p.quote || !ok {
+				continue
+			}
+			synthetic := new(big.Float).Quo(baseRate, quoteRate)
+			basis := new(big.Float).Sub(direct, synthetic)
+			basis.Quo(basis, synthetic).Mul(basis, big.NewFloat(basisPoints))
+			result = append(result, dtos.Triangle{
+				ProductId: productId,
+				Via:       via,
+				Direct:    dtos.NewDecimal(direct),
+				Synthetic: dtos.NewDecimal(synthetic),
+				BasisBps:  dtos.NewDecimal(basis),
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ProductId != result[j].ProductId {
+			return result[i].ProductId < result[j].ProductId
+		}
+		return result[i].Via < result[j].Via
+	})
+	return result
+}
@@ -0,0 +1,52 @@
+package calculator
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriangles(t *testing.T) {
+	tests := []struct {
+		name  string
+		vwaps map[string]*big.Float
+		want  map[string]float64
+	}{
+		{
+			name: "test btc eth usd triangle",
+			vwaps: map[string]*big.Float{
+				"BTC-USD": big.NewFloat(50000),
+				"ETH-USD": big.NewFloat(4000),
+				"ETH-BTC": big.NewFloat(0.081),
+				"SOL-EUR": big.NewFloat(150),
+			},
+			want: map[string]float64{
+				"BTC-USD via ETH": 125.0,
+				"ETH-BTC via USD": 125.0,
+				"ETH-USD via BTC": (4000.0 - 4050.0) / 4050.0 * basisPoints,
+			},
+		},
+		{
+			name: "test no triangle",
+			vwaps: map[string]*big.Float{
+				"BTC-USD": big.NewFloat(50000),
+				"ETH-EUR": big.NewFloat(4000),
+				"INVALID": big.NewFloat(1),
+			},
+			want: map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := triangles(tt.vwaps)
+			assert.Len(t, result, len(tt.want))
+			for _, triangle := range result {
+				want, ok := tt.want[triangle.ProductId+" via "+triangle.Via]
+				assert.True(t, ok)
+				basis := triangle.BasisBps.Float64()
+				assert.InDelta(t, want, basis, 1e-6)
+			}
+		})
+	}
+}
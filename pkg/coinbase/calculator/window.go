@@ -0,0 +1,137 @@
+package calculator
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+	"vwap/pkg/dtos"
+)
+
+// Window defines a sliding window over the trades of a product, bounded by trade count,
+// by trade time or by both, whichever holds fewer trades
+type Window struct {
+	Trades   int
+	Duration time.Duration
+}
+
+// Name identifies the window in the emitted results, e.g. "200" or "5m"
+func (w Window) Name() string {
+	switch {
+	case w.Duration <= 0:
+		return fmt.Sprintf("%d", w.Trades)
+	case w.Trades <= 0:
+		return formatDuration(w.Duration)
+	default:
+		return fmt.Sprintf("%d/%s", w.Trades, formatDuration(w.Duration))
+	}
+}
+
+// formatDuration drops the zero units time.Duration.String adds, 5m instead of 5m0s
+func formatDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return d.String()
+	}
+}
+
+// windowData keeps the aggregators of a single window, the trades are kept by AvgData
+// which shares them with every window of the product
+type windowData struct {
+	window Window
+	// count is the number of newest trades of the shared storage that belong to this window
+	count       int
+	vwap        *vwapAggregator
+	aggregators []Aggregator
+	// profile is only kept by the primary window when configured
+	profile *volumeProfile
+}
+
+func newWindowData(window Window, factories []AggregatorFactory) *windowData {
+	w := &windowData{
+		window: window,
+		vwap:   newVWAPAggregator(),
+	}
+	for _, factory := range factories {
+		w.aggregators = append(w.aggregators, factory())
+	}
+	return w
+}
+
+// add accounts the newest trade of points, evicting the trades that no longer belong to the window
+func (w *windowData) add(points []*dtos.Match, latest time.Time) {
+	point := points[len(points)-1]
+	w.vwap.Add(point)
+	for _, aggregator := range w.aggregators {
+		aggregator.Add(point)
+	}
+	if w.profile != nil {
+		w.profile.Add(point)
+	}
+	w.count++
+	for w.count > 0 && w.expired(points[len(points)-w.count], latest) {
+		evicted := points[len(points)-w.count]
+		w.vwap.Evict(evicted)
+		for _, aggregator := range w.aggregators {
+			aggregator.Evict(evicted)
+		}
+		if w.profile != nil {
+			w.profile.Evict(evicted)
+		}
+		w.count--
+	}
+}
+
+// expired tells whether the oldest trade of the window has to leave it
+func (w *windowData) expired(oldest *dtos.Match, latest time.Time) bool {
+	if w.window.Trades > 0 && w.count > w.window.Trades {
+		return true
+	}
+	return w.window.Duration > 0 && oldest.Time.Before(latest.Add(-w.window.Duration))
+}
+
+// aggregates returns the value of every configured aggregator by name
+func (w *windowData) aggregates() map[string]dtos.Decimal {
+	values := make(map[string]dtos.Decimal, len(w.aggregators))
+	for _, aggregator := range w.aggregators {
+		values[aggregator.Name()] = dtos.NewDecimal(aggregator.Value())
+	}
+	return values
+}
+
+// result converts the window into its emitted form
+func (w *windowData) result(ks []float64) dtos.WindowAvgs {
+	result := dtos.WindowAvgs{}
+	if w.count == 0 {
+		return result
+	}
+	vwap := w.vwap.Value()
+	result.Vwap = dtos.NewDecimal(vwap)
+	if len(w.aggregators) > 0 {
+		result.Aggregates = w.aggregates()
+	}
+	if len(ks) > 0 {
+		result.Bands = bandsAround(vwap, w.vwap.Variance(), ks)
+	}
+	return result
+}
+
+// bandsAround returns the vwap ± k·σ bands for every k, σ being the volume weighted standard deviation
+func bandsAround(vwap, variance *big.Float, ks []float64) []dtos.Band {
+	stdDev := new(big.Float).Sqrt(variance)
+	bands := make([]dtos.Band, 0, len(ks))
+	for _, k := range ks {
+		offset := new(big.Float).Mul(stdDev, big.NewFloat(k))
+		bands = append(bands, dtos.Band{
+			K:     k,
+			Upper: dtos.NewDecimal(new(big.Float).Add(vwap, offset)),
+			Lower: dtos.NewDecimal(new(big.Float).Sub(vwap, offset)),
+		})
+	}
+	return bands
+}
@@ -0,0 +1,60 @@
+package calculator
+
+import (
+	"math/big"
+	"testing"
+	"time"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow_Name(t *testing.T) {
+	tests := []struct {
+		window Window
+		want   string
+	}{
+		{window: Window{Trades: 200}, want: "200"},
+		{window: Window{Duration: 5 * time.Minute}, want: "5m"},
+		{window: Window{Duration: time.Hour}, want: "1h"},
+		{window: Window{Duration: 90 * time.Second}, want: "90s"},
+		{window: Window{Trades: 50, Duration: 15 * time.Minute}, want: "50/15m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.window.Name())
+		})
+	}
+}
+
+func TestAvgData_Windows(t *testing.T) {
+	start := time.Now()
+	a := newAvgData(ProductConfig{
+		Windows: []Window{
+			{Trades: 2},
+			{Trades: 4},
+			{Duration: 2 * time.Second},
+		},
+		Aggregators: []AggregatorFactory{NewSMAAggregator},
+	})
+	for i, price := range []float64{1.0, 2.0, 3.0, 4.0, 5.0, 6.0} {
+		a.Add(&dtos.Match{
+			Time:  start.Add(time.Duration(i) * time.Second),
+			Price: big.NewFloat(price),
+			Size:  big.NewFloat(1.0),
+		})
+	}
+	// the widest window holds the last four trades
+	assert.Len(t, a.points, 4)
+	results := a.windowResults([]float64{1})
+	for name, want := range map[string]float64{"2": 5.5, "4": 4.5, "2s": 5.0} {
+		vwap := results[name].Vwap.Float64()
+		assert.Equal(t, want, vwap, name)
+		sma := results[name].Aggregates["sma"].Float64()
+		assert.Equal(t, want, sma, name)
+		assert.Len(t, results[name].Bands, 1)
+	}
+	// the primary window drives the product vwap
+	vwap, _ := a.CalculatedVwap.Float64()
+	assert.Equal(t, 5.5, vwap)
+}
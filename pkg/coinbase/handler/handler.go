@@ -2,61 +2,406 @@ package handler
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"log"
+	"sync"
+	"time"
 	pkg "vwap/pkg"
+	"vwap/pkg/coinbase/auth"
 	"vwap/pkg/dtos"
 )
 
 var _ pkg.VWAPHandler = &CoinbaseHandler{}
 
 const (
-	url = "wss://ws-feed.exchange.coinbase.com"
+	// ProductionURL is the default feed, SandboxURL the public feed of the sandbox
+	ProductionURL = "wss://ws-feed.exchange.coinbase.com"
+	SandboxURL    = "wss://ws-feed-public.sandbox.exchange.coinbase.com"
+	// defaultLivenessTimeout is how long the feed may stay silent before the handler is unhealthy
+	defaultLivenessTimeout = 30 * time.Second
+	// defaultHeartbeatTimeout is how long a product may go without heartbeats, sent every second, before it's stale
+	defaultHeartbeatTimeout = 5 * time.Second
+	// eventsBuffer is how many events are kept while nobody reads them, later ones are logged instead
+	eventsBuffer = 64
 )
 
 type CoinbaseHandler struct {
-	websocket      pkg.Websocket
-	vwapCalculator pkg.VWAPCalculator
+	websocket        pkg.Websocket
+	vwapCalculator   pkg.VWAPCalculator
+	endpoint         pkg.Endpoint
+	livenessTimeout  time.Duration
+	warmWindow       time.Duration
+	heartbeatTimeout time.Duration
+	ticker           bool
+	level2           bool
+	// lastMatchInWindow forwards the last match as a regular trade instead of a sequence baseline
+	lastMatchInWindow bool
+	credentials       *auth.Credentials
+	userChannel       bool
+	// productsPerConnection spreads the products across connections created by newWebsocket,
+	// zero keeps every product on the websocket of the handler
+	productsPerConnection int
+	newWebsocket          func() pkg.Websocket
+	events                chan *dtos.Event
+
+	mu     sync.Mutex
+	shards []*shard
+}
+
+// Option configures optional behaviour of the handler
+type Option func(*CoinbaseHandler)
+
+// WithURL connects to the given feed instead of the production one, e.g. SandboxURL or a local mock
+func WithURL(url string) Option {
+	return func(c *CoinbaseHandler) {
+		c.endpoint.URL = url
+	}
+}
+
+// WithOrigin sets the origin sent on the websocket handshake
+func WithOrigin(origin string) Option {
+	return func(c *CoinbaseHandler) {
+		c.endpoint.Origin = origin
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the connection, e.g. a CA bundle, client certificates
+// or a minimum version
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *CoinbaseHandler) {
+		c.endpoint.TLSConfig = config
+	}
+}
+
+// WithDialTimeout bounds the connection to the feed, the handshake included
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(c *CoinbaseHandler) {
+		c.endpoint.DialTimeout = timeout
+	}
+}
+
+// WithProxy connects through the given http, https or socks5 proxy instead of the one of the
+// environment variables
+func WithProxy(proxyURL string) Option {
+	return func(c *CoinbaseHandler) {
+		c.endpoint.Proxy = proxyURL
+	}
+}
+
+// WithPingInterval pings the feed at the given interval, so the connection is kept alive and its
+// pongs count against the read timeout
+func WithPingInterval(interval time.Duration) Option {
+	return func(c *CoinbaseHandler) {
+		c.endpoint.PingInterval = interval
+	}
+}
+
+// WithReadTimeout drops and restores the connection when no frame arrives within the timeout
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(c *CoinbaseHandler) {
+		c.endpoint.ReadTimeout = timeout
+	}
+}
+
+// WithWriteTimeout drops and restores the connection when a write exceeds the timeout
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(c *CoinbaseHandler) {
+		c.endpoint.WriteTimeout = timeout
+	}
+}
+
+// WithLivenessTimeout sets how long the feed may stay silent before Healthy fails
+func WithLivenessTimeout(timeout time.Duration) Option {
+	return func(c *CoinbaseHandler) {
+		c.livenessTimeout = timeout
+	}
+}
+
+// WithWarmWindow makes products without trades count as ready once the window has elapsed
+// since the subscription was acknowledged, by default every product must trade first
+func WithWarmWindow(window time.Duration) Option {
+	return func(c *CoinbaseHandler) {
+		c.warmWindow = window
+	}
+}
+
+// WithHeartbeatTimeout sets how long a product may go without heartbeats before a stale feed event is raised,
+// zero disables the check
+func WithHeartbeatTimeout(timeout time.Duration) Option {
+	return func(c *CoinbaseHandler) {
+		c.heartbeatTimeout = timeout
+	}
+}
+
+// WithTicker also subscribes to the ticker channel, so emissions hold the best bid and ask of every product
+func WithTicker() Option {
+	return func(c *CoinbaseHandler) {
+		c.ticker = true
+	}
+}
+
+// WithLevel2 also subscribes to the level2 channel, so the calculator can maintain the order book of every product
+func WithLevel2() Option {
+	return func(c *CoinbaseHandler) {
+		c.level2 = true
+	}
+}
+
+// WithLastMatchInWindow accounts the last trade Coinbase sends on subscribing in the windows, by default
+// it only seeds the sequence baseline of its product
+func WithLastMatchInWindow() Option {
+	return func(c *CoinbaseHandler) {
+		c.lastMatchInWindow = true
+	}
+}
+
+// WithCredentials authenticates the subscription, so the trades of our own orders are marked as such
+func WithCredentials(credentials auth.Credentials) Option {
+	return func(c *CoinbaseHandler) {
+		c.credentials = &credentials
+	}
+}
+
+// WithUserChannel also subscribes to the user channel, which sends the messages of our own orders.
+// It requires the credentials.
+func WithUserChannel() Option {
+	return func(c *CoinbaseHandler) {
+		c.userChannel = true
+	}
+}
+
+// WithSharding spreads the products across connections of at most productsPerConnection products,
+// the websocket of the handler carries the first ones and newWebsocket creates the others
+func WithSharding(productsPerConnection int, newWebsocket func() pkg.Websocket) Option {
+	return func(c *CoinbaseHandler) {
+		c.productsPerConnection = productsPerConnection
+		c.newWebsocket = newWebsocket
+	}
 }
 
 // createSubscriptionPayload it's a helper function for creating the subscription payload
 func (c *CoinbaseHandler) createSubscriptionPayload(productIds []string) *dtos.Subscription {
-	return &dtos.Subscription{
+	channels := []string{"matches", "heartbeat"}
+	if c.ticker {
+		channels = append(channels, "ticker")
+	}
+	if c.level2 {
+		channels = append(channels, "level2")
+	}
+	if c.userChannel {
+		channels = append(channels, "user")
+	}
+	subscription := &dtos.Subscription{
 		Type:       "subscribe",
 		ProductIds: productIds,
-		Channels:   []string{"matches"},
+		Channels:   channels,
+	}
+	if c.credentials != nil {
+		subscription.Sign = c.credentials.Sign
 	}
+	return subscription
 }
 
-// Subscribe function subscribes to the coinbase match channel in order to process responses
+// Subscribe function subscribes to the coinbase match and heartbeat channels in order to process responses
 func (c *CoinbaseHandler) Subscribe(ctx context.Context, productIds ...string) (<-chan *dtos.ProductAvgs, error) {
 	if len(productIds) == 0 {
 		return nil, errors.New("no product id provided")
 	}
-	err := c.websocket.Connect(url)
+	if c.userChannel && c.credentials == nil {
+		return nil, errors.New("the user channel requires credentials")
+	}
+	endpoint := c.endpoint
+	if endpoint.URL == "" {
+		endpoint.URL = ProductionURL
+	}
+	shards := c.createShards(productIds)
+	c.mu.Lock()
+	c.shards = shards
+	c.mu.Unlock()
+	for _, s := range shards {
+		s.state.start(s.products)
+	}
+	feeds := make([]<-chan dtos.Message, len(shards))
+	for i, s := range shards {
+		websocketChan, err := c.subscribeShard(ctx, s, endpoint)
+		if err != nil {
+			c.fail(shards, i)
+			return nil, err
+		}
+		feeds[i] = websocketChan
+	}
+	// every connection is merged into the calculator input
+	calculatorChan := make(chan dtos.Message)
+	responseChan, err := c.vwapCalculator.CalcAvg(ctx, calculatorChan)
 	if err != nil {
+		c.fail(shards, len(shards))
 		return nil, err
 	}
-	subscription := c.createSubscriptionPayload(productIds)
-	websocketChan, err := c.websocket.Subscribe(ctx, subscription)
-	if err != nil {
+	for i, s := range shards {
+		go c.relay(ctx, s, feeds[i], calculatorChan)
+	}
+	subscribedProducts.Set(float64(len(productIds)))
+	connections.Set(float64(len(shards)))
+
+	return responseChan, nil
+}
+
+// subscribeShard connects the shard and subscribes to its products
+func (c *CoinbaseHandler) subscribeShard(ctx context.Context, s *shard, endpoint pkg.Endpoint) (<-chan dtos.Message, error) {
+	if err := s.websocket.Connect(endpoint); err != nil {
 		return nil, err
 	}
-	responseChan, err := c.vwapCalculator.CalcAvg(ctx, websocketChan)
+	s.state.transition(Subscribing)
+	websocketChan, err := s.websocket.Subscribe(ctx, c.createSubscriptionPayload(s.products))
 	if err != nil {
+		// the connection is up even though the subscription failed
+		go s.websocket.Close()
 		return nil, err
 	}
+	return websocketChan, nil
+}
 
-	return responseChan, nil
+// relay forwards the feed of a connection to the calculator, keeping track of the connection state
+// and of the heartbeats on the way
+func (c *CoinbaseHandler) relay(ctx context.Context, s *shard, websocketChan <-chan dtos.Message, calculatorChan chan<- dtos.Message) {
+	var heartbeatTick <-chan time.Time
+	if c.heartbeatTimeout > 0 {
+		ticker := time.NewTicker(c.heartbeatTimeout / 2)
+		defer ticker.Stop()
+		heartbeatTick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeatTick:
+			for _, event := range s.state.checkHeartbeats(c.heartbeatTimeout) {
+				c.sendEvent(event)
+			}
+		case msg, ok := <-websocketChan:
+			if !ok {
+				s.state.transition(Disconnected)
+				return
+			}
+			if lastMatch, ok := msg.(*dtos.LastMatch); ok && c.lastMatchInWindow {
+				msg = &lastMatch.Match
+			}
+			// errors only concern the products of the connection, e.g. only their books have to be rebuilt
+			if lost, ok := msg.(*dtos.Error); ok && (lost.Type == connectionErrorType || lost.Type == errorType) {
+				scoped := *lost
+				scoped.ProductIds = s.products
+				msg = &scoped
+			}
+			if event := s.state.observe(msg); event != nil {
+				c.sendEvent(event)
+			}
+			select {
+			case calculatorChan <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// sendEvent reports the event without ever blocking the feed
+func (c *CoinbaseHandler) sendEvent(event *dtos.Event) {
+	select {
+	case c.events <- event:
+	default:
+		log.Printf("events channel full, dropping %s event of %s: %s", event.Type, event.ProductId, event.Message)
+	}
+}
+
+// Events returns the channel the handler reports its events on, e.g. stale feeds
+func (c *CoinbaseHandler) Events() <-chan *dtos.Event {
+	return c.events
+}
+
+// LastHeartbeat returns when the last heartbeat of the product arrived and its sequence,
+// the time is zero when none arrived yet
+func (c *CoinbaseHandler) LastHeartbeat(productId string) (time.Time, int64) {
+	for _, s := range c.connections() {
+		if s.carries(productId) {
+			return s.state.lastHeartbeat(productId)
+		}
+	}
+	return time.Time{}, 0
+}
+
+// fail disconnects every connection of a failed subscription, closing the subscribed ones
+func (c *CoinbaseHandler) fail(shards []*shard, subscribed int) {
+	subscribeErrors.Inc()
+	for i, s := range shards {
+		s.state.transition(Disconnected)
+		if i < subscribed {
+			go s.websocket.Close()
+		}
+	}
+}
+
+// State returns the state of the feed connections, i.e. the least advanced one
+func (c *CoinbaseHandler) State() ConnectionState {
+	shards := c.connections()
+	if len(shards) == 0 {
+		return Disconnected
+	}
+	state := Subscribed
+	for _, s := range shards {
+		if current := s.state.current(); current < state {
+			state = current
+		}
+	}
+	return state
+}
+
+// ConnectionStates returns the state of every connection the products are spread across
+func (c *CoinbaseHandler) ConnectionStates() []ConnectionState {
+	shards := c.connections()
+	states := make([]ConnectionState, len(shards))
+	for i, s := range shards {
+		states[i] = s.state.current()
+	}
+	return states
+}
+
+// Healthy fails when no message, heartbeats included, arrived within the liveness timeout on any connection
+func (c *CoinbaseHandler) Healthy() error {
+	return c.check(func(state *feedState) error {
+		return state.healthy(c.livenessTimeout)
+	})
+}
+
+// Ready fails until every subscription is acknowledged and every product has traded or warmed up
+func (c *CoinbaseHandler) Ready() error {
+	return c.check(func(state *feedState) error {
+		return state.ready(c.livenessTimeout, c.warmWindow)
+	})
 }
 
 func (c *CoinbaseHandler) Close() {
-	go c.websocket.Close()
+	shards := c.connections()
+	if len(shards) == 0 {
+		go c.websocket.Close()
+	}
+	for _, s := range shards {
+		s.state.transition(Disconnected)
+		go s.websocket.Close()
+	}
 	go c.vwapCalculator.Close()
 }
 
-func NewCoinbaseHandler(websocket pkg.Websocket, vwapCalculator pkg.VWAPCalculator) *CoinbaseHandler {
-	return &CoinbaseHandler{
-		websocket:      websocket,
-		vwapCalculator: vwapCalculator,
+func NewCoinbaseHandler(websocket pkg.Websocket, vwapCalculator pkg.VWAPCalculator, opts ...Option) *CoinbaseHandler {
+	c := &CoinbaseHandler{
+		websocket:        websocket,
+		vwapCalculator:   vwapCalculator,
+		livenessTimeout:  defaultLivenessTimeout,
+		heartbeatTimeout: defaultHeartbeatTimeout,
+		events:           make(chan *dtos.Event, eventsBuffer),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
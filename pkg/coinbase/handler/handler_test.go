@@ -2,14 +2,23 @@ package handler
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"math/big"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+	pkg "vwap/pkg"
+	"vwap/pkg/coinbase/auth"
 	"vwap/pkg/coinbase/calculator"
 	"vwap/pkg/dtos"
 	"vwap/pkg/mocks"
+	stdwebsocket "vwap/pkg/std/websocket"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/websocket"
 )
 
 func TestCoinbaseHandler_Subscribe(t *testing.T) {
@@ -75,13 +84,13 @@ func TestCoinbaseHandler_Subscribe(t *testing.T) {
 			switch tt.testType {
 			case success:
 				websocket := &mocks.Websocket{}
-				vwapCalculator := calculator.NewCoinbaseCalculator(0.0)
+				vwapCalculator, _ := calculator.NewCoinbaseCalculator(0.0)
 				c := &CoinbaseHandler{
 					websocket:      websocket,
 					vwapCalculator: vwapCalculator,
 				}
-				responseChan := func() <-chan *dtos.Response {
-					coinbaseResponses := []*dtos.Response{
+				responseChan := func() <-chan dtos.Message {
+					coinbaseResponses := []*dtos.Match{
 						{
 							ProductId: "BTC-USD",
 							Type:      "match",
@@ -95,7 +104,7 @@ func TestCoinbaseHandler_Subscribe(t *testing.T) {
 							Size:      big.NewFloat(4.0),
 						},
 					}
-					response := make(chan *dtos.Response)
+					response := make(chan dtos.Message)
 					go func() {
 						for _, res := range coinbaseResponses {
 							response <- res
@@ -104,63 +113,69 @@ func TestCoinbaseHandler_Subscribe(t *testing.T) {
 					return response
 				}()
 
-				websocket.On("Connect", url).Return(nil)
+				websocket.On("Connect", pkg.Endpoint{URL: ProductionURL}).Return(nil)
 				websocket.On("Subscribe", ctx, &dtos.Subscription{
 					Type:       "subscribe",
 					ProductIds: tt.args.productIds,
-					Channels:   []string{"matches"},
+					Channels:   []string{"matches", "heartbeat"},
 				}).Return(responseChan, nil)
 				websocket.On("Close").Return()
 				productAvgs, err := c.Subscribe(tt.args.ctx, tt.args.productIds...)
 				assert.NotNil(t, productAvgs)
 				assert.NoError(t, err)
 				vwapCalc := <-productAvgs
-				assert.NotNil(t, vwapCalc.Products["BTC-USD"])
+				assert.NotEmpty(t, vwapCalc.Products["BTC-USD"])
 				c.Close()
 			case websocketConnectError:
 				websocket := &mocks.Websocket{}
-				vwapCalculator := calculator.NewCoinbaseCalculator(0.0)
+				vwapCalculator, _ := calculator.NewCoinbaseCalculator(0.0)
 				c := &CoinbaseHandler{
 					websocket:      websocket,
 					vwapCalculator: vwapCalculator,
 				}
-				websocket.On("Connect", url).Return(errors.New(""))
+				websocket.On("Connect", pkg.Endpoint{URL: ProductionURL}).Return(errors.New(""))
 				productAvgs, err := c.Subscribe(tt.args.ctx, tt.args.productIds...)
 				assert.Nil(t, productAvgs)
 				assert.Error(t, err)
 			case websocketSubscribeError:
 				websocket := &mocks.Websocket{}
-				vwapCalculator := calculator.NewCoinbaseCalculator(0.0)
+				vwapCalculator, _ := calculator.NewCoinbaseCalculator(0.0)
 				c := &CoinbaseHandler{
 					websocket:      websocket,
 					vwapCalculator: vwapCalculator,
 				}
-				websocket.On("Connect", url).Return(nil)
+				websocket.On("Connect", pkg.Endpoint{URL: ProductionURL}).Return(nil)
 				websocket.On("Subscribe", ctx, &dtos.Subscription{
 					Type:       "subscribe",
 					ProductIds: tt.args.productIds,
-					Channels:   []string{"matches"},
+					Channels:   []string{"matches", "heartbeat"},
 				}).Return(nil, errors.New(""))
+				// the connection is closed even though only the subscription failed
+				closed := make(chan struct{})
+				websocket.On("Close").Run(func(mock.Arguments) { close(closed) }).Return()
 				productAvgs, err := c.Subscribe(tt.args.ctx, tt.args.productIds...)
 				assert.Nil(t, productAvgs)
 				assert.Error(t, err)
+				select {
+				case <-closed:
+				case <-time.After(time.Second):
+					assert.Fail(t, "the connection was not closed")
+				}
 			case websocketResponseError:
 				websocket := &mocks.Websocket{}
-				vwapCalculator := calculator.NewCoinbaseCalculator(0.0)
+				vwapCalculator, _ := calculator.NewCoinbaseCalculator(0.0)
 				c := &CoinbaseHandler{
 					websocket:      websocket,
 					vwapCalculator: vwapCalculator,
 				}
-				responseChan := func() <-chan *dtos.Response {
-					coinbaseResponses := []*dtos.Response{
+				responseChan := func() <-chan dtos.Message {
+					coinbaseResponses := []*dtos.Error{
 						{
-							Type: "error",
-							Error: dtos.Error{
-								Message: "unexpected error",
-							},
+							Type:    "error",
+							Message: "unexpected error",
 						},
 					}
-					response := make(chan *dtos.Response)
+					response := make(chan dtos.Message)
 					go func() {
 						for _, res := range coinbaseResponses {
 							response <- res
@@ -169,11 +184,11 @@ func TestCoinbaseHandler_Subscribe(t *testing.T) {
 					return response
 				}()
 
-				websocket.On("Connect", url).Return(nil)
+				websocket.On("Connect", pkg.Endpoint{URL: ProductionURL}).Return(nil)
 				websocket.On("Subscribe", ctx, &dtos.Subscription{
 					Type:       "subscribe",
 					ProductIds: tt.args.productIds,
-					Channels:   []string{"matches"},
+					Channels:   []string{"matches", "heartbeat"},
 				}).Return(responseChan, nil)
 				productAvgs, err := c.Subscribe(tt.args.ctx, tt.args.productIds...)
 				assert.NotNil(t, productAvgs)
@@ -185,14 +200,17 @@ func TestCoinbaseHandler_Subscribe(t *testing.T) {
 					websocket:      websocket,
 					vwapCalculator: vwapCalculator,
 				}
-				responseChan := make(<-chan *dtos.Response)
-				websocket.On("Connect", url).Return(nil)
+				responseChan := make(<-chan dtos.Message)
+				websocket.On("Connect", pkg.Endpoint{URL: ProductionURL}).Return(nil)
 				websocket.On("Subscribe", ctx, &dtos.Subscription{
 					Type:       "subscribe",
 					ProductIds: tt.args.productIds,
-					Channels:   []string{"matches"},
+					Channels:   []string{"matches", "heartbeat"},
 				}).Return(responseChan, nil)
-				vwapCalculator.On("CalcAvg", ctx, responseChan).Return(nil, errors.New(""))
+				// the handler relays the feed to the calculator through its own channel
+				vwapCalculator.On("CalcAvg", ctx, mock.Anything).Return(nil, errors.New(""))
+				// the subscribed connection is closed on failure
+				websocket.On("Close").Return()
 				productAvgs, err := c.Subscribe(tt.args.ctx, tt.args.productIds...)
 				assert.Nil(t, productAvgs)
 				assert.Error(t, err)
@@ -210,3 +228,477 @@ func TestCoinbaseHandler_Subscribe(t *testing.T) {
 		})
 	}
 }
+
+func TestCoinbaseHandler_Health(t *testing.T) {
+	const (
+		notStarted = iota
+		waitingForAck
+		waitingForTrades
+		ready
+		warmWindow
+		stale
+		reconnecting
+	)
+	productIds := []string{"BTC-USD", "ETH-USD"}
+	tests := []struct {
+		name        string
+		testType    int
+		wantState   ConnectionState
+		wantHealthy bool
+		wantReady   bool
+	}{
+		{
+			name:      "test not started",
+			testType:  notStarted,
+			wantState: Disconnected,
+		},
+		{
+			name:        "test waiting for the subscription acknowledgement",
+			testType:    waitingForAck,
+			wantState:   Subscribing,
+			wantHealthy: true,
+		},
+		{
+			name:        "test waiting for every product to trade",
+			testType:    waitingForTrades,
+			wantState:   Subscribed,
+			wantHealthy: true,
+		},
+		{
+			name:        "test ready once every product traded",
+			testType:    ready,
+			wantState:   Subscribed,
+			wantHealthy: true,
+			wantReady:   true,
+		},
+		{
+			name:        "test ready after the warm window",
+			testType:    warmWindow,
+			wantState:   Subscribed,
+			wantHealthy: true,
+			wantReady:   true,
+		},
+		{
+			name:      "test unhealthy when the feed is silent",
+			testType:  stale,
+			wantState: Subscribed,
+		},
+		{
+			name:        "test not ready while reconnecting",
+			testType:    reconnecting,
+			wantState:   Subscribing,
+			wantHealthy: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			websocket := &mocks.Websocket{}
+			opts := []Option{WithLivenessTimeout(time.Minute)}
+			switch tt.testType {
+			case warmWindow:
+				opts = append(opts, WithWarmWindow(time.Millisecond))
+			case stale:
+				opts = []Option{WithLivenessTimeout(10 * time.Millisecond)}
+			}
+			vwapCalculator, _ := calculator.NewCoinbaseCalculator(0.0)
+			c := NewCoinbaseHandler(websocket, vwapCalculator, opts...)
+			feed := make(chan dtos.Message)
+			websocket.On("Connect", pkg.Endpoint{URL: ProductionURL}).Return(nil)
+			websocket.On("Subscribe", ctx, mock.Anything).Return((<-chan dtos.Message)(feed), nil)
+			if tt.testType != notStarted {
+				productAvgs, err := c.Subscribe(ctx, productIds...)
+				assert.NoError(t, err)
+				// drains the emissions so the relay never blocks
+				go func() {
+					for range productAvgs {
+					}
+				}()
+			}
+			send := func(msgs ...dtos.Message) {
+				for _, msg := range msgs {
+					feed <- msg
+				}
+			}
+			ack := &dtos.Subscriptions{Type: "subscriptions"}
+			match := func(productId string) *dtos.Match {
+				return &dtos.Match{
+					Type:      "match",
+					ProductId: productId,
+					Price:     big.NewFloat(4.0),
+					Size:      big.NewFloat(1.0),
+				}
+			}
+			switch tt.testType {
+			case waitingForTrades:
+				send(ack, match("BTC-USD"))
+			case ready:
+				send(ack, match("BTC-USD"), match("ETH-USD"))
+			case warmWindow:
+				send(ack, match("BTC-USD"))
+				time.Sleep(5 * time.Millisecond)
+			case stale:
+				send(ack, match("BTC-USD"), match("ETH-USD"))
+				time.Sleep(20 * time.Millisecond)
+			case reconnecting:
+				send(ack, match("BTC-USD"), match("ETH-USD"), &dtos.Error{Type: "connection_error"})
+			}
+			// an unbuffered send only proves the relay received the message, not that it observed it
+			time.Sleep(5 * time.Millisecond)
+			assert.Equal(t, tt.wantState, c.State())
+			assert.Equal(t, tt.wantHealthy, c.Healthy() == nil)
+			assert.Equal(t, tt.wantReady, c.Ready() == nil)
+		})
+	}
+}
+
+func TestCoinbaseHandler_Heartbeats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	websocket := &mocks.Websocket{}
+	vwapCalculator, _ := calculator.NewCoinbaseCalculator(0.0)
+	c := NewCoinbaseHandler(websocket, vwapCalculator,
+		WithHeartbeatTimeout(20*time.Millisecond),
+		WithWarmWindow(time.Millisecond),
+	)
+	feed := make(chan dtos.Message)
+	websocket.On("Connect", pkg.Endpoint{URL: ProductionURL}).Return(nil)
+	websocket.On("Subscribe", ctx, &dtos.Subscription{
+		Type:       "subscribe",
+		ProductIds: []string{"BTC-USD", "ETH-USD"},
+		Channels:   []string{"matches", "heartbeat"},
+	}).Return((<-chan dtos.Message)(feed), nil)
+	productAvgs, err := c.Subscribe(ctx, "BTC-USD", "ETH-USD")
+	assert.NoError(t, err)
+	go func() {
+		for range productAvgs {
+		}
+	}()
+	heartbeat := func(productId string, sequence int64) *dtos.Heartbeat {
+		return &dtos.Heartbeat{Type: "heartbeat", ProductId: productId, Sequence: sequence}
+	}
+	feed <- &dtos.Subscriptions{Type: "subscriptions"}
+	feed <- heartbeat("BTC-USD", 10)
+	feed <- heartbeat("ETH-USD", 20)
+
+	// both products stop sending heartbeats, each is reported once
+	stale := map[string]bool{}
+	for len(stale) < 2 {
+		select {
+		case event := <-c.Events():
+			assert.Equal(t, dtos.StaleFeedEvent, event.Type)
+			assert.False(t, stale[event.ProductId])
+			stale[event.ProductId] = true
+		case <-time.After(time.Second):
+			t.Fatal("no stale feed event")
+		}
+	}
+	assert.Error(t, c.Ready())
+	at, sequence := c.LastHeartbeat("ETH-USD")
+	assert.False(t, at.IsZero())
+	assert.Equal(t, int64(20), sequence)
+
+	feed <- heartbeat("BTC-USD", 11)
+	select {
+	case event := <-c.Events():
+		assert.Equal(t, dtos.FeedRecoveredEvent, event.Type)
+		assert.Equal(t, "BTC-USD", event.ProductId)
+	case <-time.After(time.Second):
+		t.Fatal("no feed recovered event")
+	}
+	_, sequence = c.LastHeartbeat("BTC-USD")
+	assert.Equal(t, int64(11), sequence)
+}
+
+func TestCoinbaseHandler_createSubscriptionPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{
+			name: "test matches and heartbeats by default",
+			want: []string{"matches", "heartbeat"},
+		},
+		{
+			name: "test ticker opt in",
+			opts: []Option{WithTicker()},
+			want: []string{"matches", "heartbeat", "ticker"},
+		},
+		{
+			name: "test user channel opt in",
+			opts: []Option{WithCredentials(auth.Credentials{}), WithUserChannel()},
+			want: []string{"matches", "heartbeat", "user"},
+		},
+		{
+			name: "test ticker and level2 opt in",
+			opts: []Option{WithLevel2(), WithTicker()},
+			want: []string{"matches", "heartbeat", "ticker", "level2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCoinbaseHandler(&mocks.Websocket{}, &mocks.VWAPCalculator{}, tt.opts...)
+			assert.Equal(t, tt.want, c.createSubscriptionPayload([]string{"BTC-USD"}).Channels)
+		})
+	}
+}
+
+func TestCoinbaseHandler_LastMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantMatch bool
+	}{
+		{
+			name: "test last match relayed as a baseline",
+		},
+		{
+			name:      "test last match relayed as a trade",
+			opts:      []Option{WithLastMatchInWindow()},
+			wantMatch: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			websocket := &mocks.Websocket{}
+			vwapCalculator := &mocks.VWAPCalculator{}
+			c := NewCoinbaseHandler(websocket, vwapCalculator, append(tt.opts, WithWarmWindow(time.Hour))...)
+			feed := make(chan dtos.Message)
+			var calculatorChan <-chan dtos.Message
+			websocket.On("Connect", pkg.Endpoint{URL: ProductionURL}).Return(nil)
+			websocket.On("Subscribe", ctx, mock.Anything).Return((<-chan dtos.Message)(feed), nil)
+			vwapCalculator.On("CalcAvg", ctx, mock.Anything).Run(func(args mock.Arguments) {
+				calculatorChan = args.Get(1).(<-chan dtos.Message)
+			}).Return((<-chan *dtos.ProductAvgs)(make(chan *dtos.ProductAvgs)), nil)
+			_, err := c.Subscribe(ctx, "BTC-USD")
+			assert.NoError(t, err)
+
+			feed <- &dtos.Subscriptions{Type: "subscriptions"}
+			<-calculatorChan
+			lastMatch := &dtos.LastMatch{Match: dtos.Match{Type: "last_match", ProductId: "BTC-USD", TradeId: 10}}
+			feed <- lastMatch
+			relayed := <-calculatorChan
+			if tt.wantMatch {
+				assert.Equal(t, &lastMatch.Match, relayed)
+				assert.NoError(t, c.Ready())
+			} else {
+				assert.Equal(t, lastMatch, relayed)
+				assert.Error(t, c.Ready())
+			}
+		})
+	}
+}
+
+func TestCoinbaseHandler_Credentials(t *testing.T) {
+	credentials := auth.Credentials{Key: "key", Secret: "dGVzdC1zZWNyZXQ=", Passphrase: "passphrase"}
+	c := NewCoinbaseHandler(&mocks.Websocket{}, &mocks.VWAPCalculator{}, WithCredentials(credentials))
+	subscription := c.createSubscriptionPayload([]string{"BTC-USD"})
+	assert.NotNil(t, subscription.Sign)
+	assert.NoError(t, subscription.Sign(subscription))
+	assert.Equal(t, "key", subscription.Key)
+	assert.NotEmpty(t, subscription.Signature)
+
+	// the user channel is only sent to authenticated subscriptions
+	c = NewCoinbaseHandler(&mocks.Websocket{}, &mocks.VWAPCalculator{}, WithUserChannel())
+	productAvgs, err := c.Subscribe(context.Background(), "BTC-USD")
+	assert.Nil(t, productAvgs)
+	assert.Error(t, err)
+}
+
+func TestCoinbaseHandler_Endpoint(t *testing.T) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	tests := []struct {
+		name string
+		opts []Option
+		want pkg.Endpoint
+	}{
+		{
+			name: "test production by default",
+			want: pkg.Endpoint{URL: ProductionURL},
+		},
+		{
+			name: "test sandbox with every option",
+			opts: []Option{
+				WithURL(SandboxURL),
+				WithOrigin("https://vwap.example"),
+				WithTLSConfig(tlsConfig),
+				WithDialTimeout(5 * time.Second),
+				WithProxy("socks5://proxy.example:1080"),
+				WithPingInterval(10 * time.Second),
+				WithReadTimeout(30 * time.Second),
+				WithWriteTimeout(10 * time.Second),
+			},
+			want: pkg.Endpoint{
+				URL:          SandboxURL,
+				Origin:       "https://vwap.example",
+				TLSConfig:    tlsConfig,
+				DialTimeout:  5 * time.Second,
+				Proxy:        "socks5://proxy.example:1080",
+				PingInterval: 10 * time.Second,
+				ReadTimeout:  30 * time.Second,
+				WriteTimeout: 10 * time.Second,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			websocket := &mocks.Websocket{}
+			c := NewCoinbaseHandler(websocket, &mocks.VWAPCalculator{}, tt.opts...)
+			websocket.On("Connect", tt.want).Return(errors.New("unreachable"))
+			_, err := c.Subscribe(context.Background(), "BTC-USD")
+			assert.Error(t, err)
+			websocket.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCoinbaseHandler_createShards(t *testing.T) {
+	productIds := []string{"BTC-USD", "ETH-USD", "ETH-BTC", "LTC-USD", "SOL-USD"}
+	newWebsocket := func() pkg.Websocket { return &mocks.Websocket{} }
+	tests := []struct {
+		name string
+		opts []Option
+		want [][]string
+	}{
+		{
+			name: "test one connection by default",
+			want: [][]string{productIds},
+		},
+		{
+			name: "test products spread across connections",
+			opts: []Option{WithSharding(2, newWebsocket)},
+			want: [][]string{{"BTC-USD", "ETH-USD"}, {"ETH-BTC", "LTC-USD"}, {"SOL-USD"}},
+		},
+		{
+			name: "test connection larger than the products",
+			opts: []Option{WithSharding(10, newWebsocket)},
+			want: [][]string{productIds},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			websocket := &mocks.Websocket{}
+			c := NewCoinbaseHandler(websocket, &mocks.VWAPCalculator{}, tt.opts...)
+			shards := c.createShards(productIds)
+			var got [][]string
+			for i, s := range shards {
+				got = append(got, s.products)
+				assert.Equal(t, i == 0, s.websocket == websocket)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCoinbaseHandler_Sharding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	shardProducts := [][]string{{"BTC-USD", "ETH-USD"}, {"ETH-BTC"}}
+	websockets := []*mocks.Websocket{{}, {}}
+	feeds := []chan dtos.Message{make(chan dtos.Message), make(chan dtos.Message)}
+	for i, websocket := range websockets {
+		websocket.On("Connect", pkg.Endpoint{URL: ProductionURL}).Return(nil)
+		websocket.On("Subscribe", ctx, &dtos.Subscription{
+			Type:       "subscribe",
+			ProductIds: shardProducts[i],
+			Channels:   []string{"matches", "heartbeat"},
+		}).Return((<-chan dtos.Message)(feeds[i]), nil)
+	}
+	vwapCalculator, _ := calculator.NewCoinbaseCalculator(0.0)
+	c := NewCoinbaseHandler(websockets[0], vwapCalculator,
+		WithLivenessTimeout(time.Minute),
+		WithSharding(2, func() pkg.Websocket { return websockets[1] }),
+	)
+	productAvgs, err := c.Subscribe(ctx, "BTC-USD", "ETH-USD", "ETH-BTC")
+	assert.NoError(t, err)
+	assert.Equal(t, []ConnectionState{Subscribing, Subscribing}, c.ConnectionStates())
+	match := func(productId string) *dtos.Match {
+		return &dtos.Match{
+			Type:      "match",
+			ProductId: productId,
+			Price:     big.NewFloat(4.0),
+			Size:      big.NewFloat(1.0),
+		}
+	}
+	ack := &dtos.Subscriptions{Type: "subscriptions"}
+
+	// every connection feeds the same calculator
+	feeds[0] <- ack
+	feeds[0] <- match("BTC-USD")
+	assert.Contains(t, (<-productAvgs).Products, "BTC-USD")
+	feeds[0] <- match("ETH-USD")
+	<-productAvgs
+	feeds[1] <- match("ETH-BTC")
+	response := <-productAvgs
+	assert.Contains(t, response.Products, "BTC-USD")
+	assert.Contains(t, response.Products, "ETH-BTC")
+
+	// the second connection was never acknowledged
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, []ConnectionState{Subscribed, Subscribing}, c.ConnectionStates())
+	assert.Equal(t, Subscribing, c.State())
+	assert.EqualError(t, c.Ready(), "connection 1: feed subscribing")
+	feeds[1] <- ack
+	feeds[1] <- &dtos.Heartbeat{Type: "heartbeat", ProductId: "ETH-BTC", Sequence: 7}
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, Subscribed, c.State())
+	assert.NoError(t, c.Healthy())
+	assert.NoError(t, c.Ready())
+	at, sequence := c.LastHeartbeat("ETH-BTC")
+	assert.False(t, at.IsZero())
+	assert.Equal(t, int64(7), sequence)
+
+	// a lost connection only affects its own products
+	feeds[1] <- &dtos.Error{Type: "connection_error"}
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, []ConnectionState{Subscribed, Subscribing}, c.ConnectionStates())
+	assert.Error(t, c.Ready())
+
+	// so does an error of the feed, the other connection keeps being calculated
+	feeds[1] <- &dtos.Error{Type: "error", Message: "failed to subscribe"}
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, []ConnectionState{Subscribed, Disconnected}, c.ConnectionStates())
+	feeds[0] <- match("BTC-USD")
+	assert.Contains(t, (<-productAvgs).Products, "BTC-USD")
+}
+
+func TestCoinbaseHandler_FailClosesSubscribed(t *testing.T) {
+	// the feed acknowledges the subscription right away, nobody reads it since the next connection fails
+	acknowledged := make(chan struct{})
+	closed := make(chan struct{}, 1)
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		var msg []byte
+		if websocket.Message.Receive(ws, &msg) != nil || websocket.Message.Send(ws, `{"type":"subscriptions"}`) != nil {
+			return
+		}
+		close(acknowledged)
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+		closed <- struct{}{}
+	}))
+	defer server.Close()
+	u := "ws" + strings.TrimPrefix(server.URL, "http")
+	failing := &mocks.Websocket{}
+	failing.On("Connect", pkg.Endpoint{URL: u}).Run(func(mock.Arguments) {
+		// fails once the reader of the first connection holds the acknowledgement
+		<-acknowledged
+		time.Sleep(20 * time.Millisecond)
+	}).Return(errors.New("unreachable"))
+	c := NewCoinbaseHandler(stdwebsocket.NewStdWebsocket(), &mocks.VWAPCalculator{},
+		WithURL(u),
+		WithSharding(1, func() pkg.Websocket { return failing }),
+	)
+	_, err := c.Subscribe(context.Background(), "BTC-USD", "ETH-USD")
+	assert.Error(t, err)
+	assert.Equal(t, []ConnectionState{Disconnected, Disconnected}, c.ConnectionStates())
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("the subscribed connection was left open")
+	}
+}
@@ -0,0 +1,16 @@
+package handler
+
+import "vwap/pkg/metrics"
+
+var (
+	subscribeErrors = metrics.NewCounter("vwap_handler_subscribe_errors_total",
+		"Subscriptions to the feed that failed.")
+	subscribedProducts = metrics.NewGauge("vwap_handler_subscribed_products",
+		"Products the handler is subscribed to.")
+	connections = metrics.NewGauge("vwap_handler_connections",
+		"Connections the products are spread across.")
+	connectionState = metrics.NewGaugeVec("vwap_handler_connection_state",
+		"Feed connection state by connection: 0 disconnected, 1 connecting, 2 subscribing, 3 subscribed.", "connection")
+	staleProducts = metrics.NewGaugeVec("vwap_handler_stale_products",
+		"Products whose heartbeats stopped arriving by connection.", "connection")
+)
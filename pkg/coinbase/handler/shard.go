@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	pkg "vwap/pkg"
+)
+
+// shard is one connection of the feed along with the products it carries
+type shard struct {
+	websocket pkg.Websocket
+	products  []string
+	state     *feedState
+}
+
+func (s *shard) carries(productId string) bool {
+	for _, p := range s.products {
+		if p == productId {
+			return true
+		}
+	}
+	return false
+}
+
+// createShards spreads the products across connections of at most productsPerConnection products,
+// in the given order, the first connection being the websocket of the handler
+func (c *CoinbaseHandler) createShards(productIds []string) []*shard {
+	size := len(productIds)
+	if c.productsPerConnection > 0 && c.newWebsocket != nil {
+		size = c.productsPerConnection
+	}
+	var shards []*shard
+	for start := 0; start < len(productIds); start += size {
+		end := start + size
+		if end > len(productIds) {
+			end = len(productIds)
+		}
+		websocket := c.websocket
+		if len(shards) > 0 {
+			websocket = c.newWebsocket()
+		}
+		shards = append(shards, &shard{
+			websocket: websocket,
+			products:  productIds[start:end:end],
+			state:     &feedState{connection: strconv.Itoa(len(shards))},
+		})
+	}
+	return shards
+}
+
+// connections returns the shards of the current subscription
+func (c *CoinbaseHandler) connections() []*shard {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.shards
+}
+
+// check runs the check against every connection, the error of a sharded feed tells which one failed
+func (c *CoinbaseHandler) check(check func(*feedState) error) error {
+	shards := c.connections()
+	if len(shards) == 0 {
+		return errors.New("feed not started")
+	}
+	for i, s := range shards {
+		if err := check(s.state); err != nil {
+			if len(shards) > 1 {
+				return fmt.Errorf("connection %d: %w", i, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
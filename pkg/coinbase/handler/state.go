@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"vwap/pkg/dtos"
+)
+
+const (
+	errorType           = "error"
+	connectionErrorType = "connection_error"
+)
+
+// ConnectionState describes where the handler is in the feed lifecycle
+type ConnectionState int
+
+const (
+	Disconnected ConnectionState = iota
+	Connecting
+	// Subscribing means the subscription was sent, either first or after a reconnection, but not acknowledged yet
+	Subscribing
+	Subscribed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Subscribing:
+		return "subscribing"
+	case Subscribed:
+		return "subscribed"
+	default:
+		return "disconnected"
+	}
+}
+
+// feedState keeps track of a connection and of the activity of its products, it's shared between
+// the goroutine relaying the connection and the health probes
+type feedState struct {
+	mu sync.Mutex
+	// connection labels the metrics of the connection
+	connection   string
+	state        ConnectionState
+	products     []string
+	traded       map[string]bool
+	startedAt    time.Time
+	subscribedAt time.Time
+	lastMessage  time.Time
+	heartbeats   map[string]heartbeat
+	stale        map[string]bool
+}
+
+// heartbeat is the last heartbeat received for a product
+type heartbeat struct {
+	at       time.Time
+	sequence int64
+}
+
+func (f *feedState) start(productIds []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.products = productIds
+	f.traded = make(map[string]bool, len(productIds))
+	f.startedAt = time.Now()
+	f.subscribedAt = time.Time{}
+	f.lastMessage = time.Time{}
+	f.heartbeats = make(map[string]heartbeat, len(productIds))
+	f.stale = make(map[string]bool)
+	staleProducts.WithLabelValues(f.connection).Set(0)
+	f.setState(Connecting)
+}
+
+func (f *feedState) transition(state ConnectionState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setState(state)
+}
+
+// setState must be called holding the lock
+func (f *feedState) setState(state ConnectionState) {
+	f.state = state
+	connectionState.WithLabelValues(f.connection).Set(float64(state))
+}
+
+// observe updates the state with a message coming from the feed, it returns the event of a
+// stale product recovering
+func (f *feedState) observe(msg dtos.Message) *dtos.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// connection errors are raised locally, they do not prove the feed is alive
+	if msg, ok := msg.(*dtos.Error); ok && msg.Type == connectionErrorType {
+		f.setState(Subscribing)
+		return nil
+	}
+	f.lastMessage = time.Now()
+	switch msg := msg.(type) {
+	case *dtos.Subscriptions:
+		if f.subscribedAt.IsZero() {
+			f.subscribedAt = f.lastMessage
+		}
+		f.setState(Subscribed)
+	case *dtos.Error:
+		if msg.Type == errorType {
+			f.setState(Disconnected)
+		}
+	// the last match only counts once it's relayed as a regular trade, otherwise the product has no vwap yet
+	case *dtos.Match:
+		f.traded[msg.ProductId] = true
+	case *dtos.Heartbeat:
+		f.heartbeats[msg.ProductId] = heartbeat{at: f.lastMessage, sequence: msg.Sequence}
+		if f.stale[msg.ProductId] {
+			delete(f.stale, msg.ProductId)
+			staleProducts.WithLabelValues(f.connection).Set(float64(len(f.stale)))
+			return &dtos.Event{
+				Type:      dtos.FeedRecoveredEvent,
+				ProductId: msg.ProductId,
+				Time:      f.lastMessage,
+				Message:   fmt.Sprintf("heartbeats resumed at sequence %d", msg.Sequence),
+			}
+		}
+	}
+	return nil
+}
+
+// checkHeartbeats returns an event for every product whose heartbeats stopped within the timeout,
+// products are only reported once until they recover. Products that never sent a heartbeat are
+// measured from the subscription acknowledgement.
+func (f *feedState) checkHeartbeats(timeout time.Duration) []*dtos.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subscribedAt.IsZero() {
+		return nil
+	}
+	now := time.Now()
+	var events []*dtos.Event
+	for _, productId := range f.products {
+		if f.stale[productId] {
+			continue
+		}
+		last, ok := f.heartbeats[productId]
+		since := f.subscribedAt
+		if ok {
+			since = last.at
+		}
+		if now.Sub(since) <= timeout {
+			continue
+		}
+		f.stale[productId] = true
+		message := "no heartbeat received"
+		if ok {
+			message = fmt.Sprintf("no heartbeat since sequence %d", last.sequence)
+		}
+		events = append(events, &dtos.Event{
+			Type:      dtos.StaleFeedEvent,
+			ProductId: productId,
+			Time:      now,
+			Message:   fmt.Sprintf("%s for %s", message, now.Sub(since).Round(time.Millisecond)),
+		})
+	}
+	staleProducts.WithLabelValues(f.connection).Set(float64(len(f.stale)))
+	return events
+}
+
+// lastHeartbeat returns when the last heartbeat of the product arrived and its sequence
+func (f *feedState) lastHeartbeat(productId string) (time.Time, int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	last := f.heartbeats[productId]
+	return last.at, last.sequence
+}
+
+func (f *feedState) current() ConnectionState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+// healthy fails when nothing arrived from the feed within the liveness timeout
+func (f *feedState) healthy(timeout time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.checkHealthy(timeout)
+}
+
+func (f *feedState) checkHealthy(timeout time.Duration) error {
+	if f.startedAt.IsZero() {
+		return errors.New("feed not started")
+	}
+	last := f.lastMessage
+	if last.IsZero() {
+		last = f.startedAt
+	}
+	if silence := time.Since(last); silence > timeout {
+		return fmt.Errorf("no message from the feed for %s", silence.Round(time.Second))
+	}
+	return nil
+}
+
+// ready succeeds once the subscription is acknowledged and every product either traded or
+// had the warm window to do it
+func (f *feedState) ready(timeout, warmWindow time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkHealthy(timeout); err != nil {
+		return err
+	}
+	if f.state != Subscribed {
+		return fmt.Errorf("feed %s", f.state)
+	}
+	for _, productId := range f.products {
+		if f.stale[productId] {
+			return fmt.Errorf("feed of %s is stale", productId)
+		}
+	}
+	warm := warmWindow > 0 && time.Since(f.subscribedAt) >= warmWindow
+	for _, productId := range f.products {
+		if !f.traded[productId] && !warm {
+			return fmt.Errorf("no trade received for %s", productId)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package dtos
+
+import (
+	"time"
+)
+
+//Alert defines the event raised when an alerting rule triggers
+type Alert struct {
+	Rule      string    `json:"rule"`
+	ProductId string    `json:"product_id"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+	Value     Decimal   `json:"value"`
+}
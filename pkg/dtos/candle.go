@@ -0,0 +1,21 @@
+package dtos
+
+import (
+	"time"
+)
+
+//Candle defines an OHLCV bar of a product, Vwap is missing for the intervals without trades.
+//Consecutive intervals without trades make up a single bar, spanning from Start to End.
+type Candle struct {
+	ProductId string        `json:"product_id"`
+	Interval  time.Duration `json:"interval"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Open      Decimal       `json:"open"`
+	High      Decimal       `json:"high"`
+	Low       Decimal       `json:"low"`
+	Close     Decimal       `json:"close"`
+	Volume    Decimal       `json:"volume"`
+	Vwap      Decimal       `json:"vwap,omitempty"`
+	Trades    int           `json:"trades"`
+}
@@ -0,0 +1,43 @@
+package dtos
+
+import (
+	"math/big"
+)
+
+//Decimal defines an immutable decimal number, serialized as a string so no precision is lost.
+//The zero value is the empty string and stands for a missing number.
+type Decimal string
+
+//NewDecimal takes a snapshot of the value of f, later changes to f are not reflected
+func NewDecimal(f *big.Float) Decimal {
+	if f == nil {
+		return ""
+	}
+	return Decimal(f.Text('f', -1))
+}
+
+//Float returns a new big.Float holding the decimal, nil when it is missing
+func (d Decimal) Float() *big.Float {
+	if d == "" {
+		return nil
+	}
+	f, _, err := big.ParseFloat(string(d), 10, 0, big.ToNearestEven)
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+//Float64 returns the nearest float64 to the decimal, zero when it is missing
+func (d Decimal) Float64() float64 {
+	f := d.Float()
+	if f == nil {
+		return 0
+	}
+	value, _ := f.Float64()
+	return value
+}
+
+func (d Decimal) String() string {
+	return string(d)
+}
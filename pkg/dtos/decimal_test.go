@@ -0,0 +1,49 @@
+package dtos
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		name  string
+		value *big.Float
+		want  string
+	}{
+		{
+			name:  "test decimal from float",
+			value: big.NewFloat(60123.45),
+			want:  "60123.45",
+		},
+		{
+			name:  "test decimal keeps parsed precision",
+			value: func() *big.Float { f, _, _ := big.ParseFloat("0.00012345678901234567", 10, 128, big.ToNearestEven); return f }(),
+			want:  "0.00012345678901234567",
+		},
+		{
+			name: "test missing decimal",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecimal(tt.value)
+			assert.Equal(t, tt.want, d.String())
+			// later changes to the source are not reflected
+			if tt.value != nil {
+				tt.value.SetInt64(0)
+				assert.Equal(t, tt.want, d.String())
+				assert.Equal(t, tt.want, NewDecimal(d.Float()).String())
+			} else {
+				assert.Nil(t, d.Float())
+			}
+			payload, err := json.Marshal(map[string]Decimal{"vwap": d})
+			assert.NoError(t, err)
+			assert.Equal(t, `{"vwap":"`+tt.want+`"}`, string(payload))
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package dtos
 
-//Error defines the error message data struct
+//Error defines the error message data struct, either sent by Coinbase or raised by the websocket client
+//with its own type, e.g. on lost connections
 type Error struct {
+	Type    string `json:"type"`
 	Message string `json:"message"`
+	Reason  string `json:"reason,omitempty"`
+	//ProductIds are the products of the lost connection, when the feed is sharded, every product when empty
+	ProductIds []string `json:"product_ids,omitempty"`
 }
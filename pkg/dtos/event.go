@@ -0,0 +1,25 @@
+package dtos
+
+import (
+	"time"
+)
+
+const (
+	//TradeRejectedEvent reports a trade discarded by the calculator filters, Trade holds it
+	TradeRejectedEvent = "trade_rejected"
+	//StaleFeedEvent reports a product whose heartbeats stopped arriving
+	StaleFeedEvent = "stale_feed"
+	//FeedRecoveredEvent reports a stale product whose heartbeats arrive again
+	FeedRecoveredEvent = "feed_recovered"
+	//BookInconsistentEvent reports an order book that failed its consistency checks, it's rebuilt from the next snapshot
+	BookInconsistentEvent = "book_inconsistent"
+)
+
+//Event defines a notable occurrence reported on the event stream, apart from the product averages
+type Event struct {
+	Type      string    `json:"type"`
+	ProductId string    `json:"product_id"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+	Trade     *Match    `json:"trade,omitempty"`
+}
@@ -0,0 +1,33 @@
+package dtos
+
+import (
+	"time"
+)
+
+//Level2 defines the messages of the Coinbase level2 channel, either a snapshot of the book or the changes to it
+type Level2 struct {
+	Type      string    `json:"type"`
+	ProductId string    `json:"product_id"`
+	Time      time.Time `json:"time"`
+	// Bids and Asks hold the price and size of every level of a snapshot
+	Bids [][2]string `json:"bids"`
+	Asks [][2]string `json:"asks"`
+	// Changes holds the side, price and new size of every level of an update, a zero size removes the level
+	Changes [][3]string `json:"changes"`
+}
+
+//BookLevel defines a price level of the order book
+type BookLevel struct {
+	Price Decimal `json:"price"`
+	Size  Decimal `json:"size"`
+}
+
+//Book defines the top of the order book of a product and how its vwap deviates from the mid price
+type Book struct {
+	Bids       []BookLevel `json:"bids"`
+	Asks       []BookLevel `json:"asks"`
+	Mid        Decimal     `json:"mid"`
+	Microprice Decimal     `json:"microprice"`
+	// VwapMidDeviation is (vwap - mid) / mid
+	VwapMidDeviation Decimal `json:"vwap_mid_deviation"`
+}
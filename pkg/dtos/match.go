@@ -0,0 +1,28 @@
+package dtos
+
+import (
+	"math/big"
+	"time"
+)
+
+//Match defines a trade of the Coinbase matches channel. On authenticated feeds, UserId and ProfileId are
+//set on the trades of our own orders.
+type Match struct {
+	Type         string     `json:"type"`
+	TradeId      int64      `json:"trade_id"`
+	Sequence     int64      `json:"sequence"`
+	MakerOrderId string     `json:"maker_order_id"`
+	TakerOrderId string     `json:"taker_order_id"`
+	Time         time.Time  `json:"time"`
+	ProductId    string     `json:"product_id"`
+	Size         *big.Float `json:"size"`
+	Price        *big.Float `json:"price"`
+	Side         string     `json:"side"`
+	UserId       string     `json:"user_id,omitempty"`
+	ProfileId    string     `json:"profile_id,omitempty"`
+}
+
+//LastMatch defines the last trade of a product, sent once on subscribing to the matches channel
+type LastMatch struct {
+	Match
+}
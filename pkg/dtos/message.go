@@ -0,0 +1,57 @@
+package dtos
+
+import (
+	"math/big"
+	"time"
+)
+
+//Message defines a message of the Coinbase feed, decoded into the struct of its type
+type Message interface {
+	MessageType() string
+}
+
+//Subscriptions defines the acknowledgement of a subscription, listing every channel subscribed to
+type Subscriptions struct {
+	Type     string                `json:"type"`
+	Channels []SubscriptionChannel `json:"channels"`
+}
+
+//SubscriptionChannel defines a channel subscribed to along with its products
+type SubscriptionChannel struct {
+	Name       string   `json:"name"`
+	ProductIds []string `json:"product_ids"`
+}
+
+//Heartbeat defines the message of the Coinbase heartbeat channel, sent every second per product
+type Heartbeat struct {
+	Type        string    `json:"type"`
+	Sequence    int64     `json:"sequence"`
+	LastTradeId int64     `json:"last_trade_id"`
+	ProductId   string    `json:"product_id"`
+	Time        time.Time `json:"time"`
+}
+
+//Order defines the lifecycle messages of our own orders on the Coinbase user channel, i.e. received,
+//open, done, change and activate. Their fills are sent as matches.
+type Order struct {
+	Type          string     `json:"type"`
+	Time          time.Time  `json:"time"`
+	ProductId     string     `json:"product_id"`
+	Sequence      int64      `json:"sequence"`
+	OrderId       string     `json:"order_id"`
+	Side          string     `json:"side"`
+	Price         *big.Float `json:"price"`
+	Size          *big.Float `json:"size"`
+	RemainingSize *big.Float `json:"remaining_size"`
+	Reason        string     `json:"reason,omitempty"`
+	UserId        string     `json:"user_id,omitempty"`
+	ProfileId     string     `json:"profile_id,omitempty"`
+}
+
+func (m *Match) MessageType() string         { return m.Type }
+func (m *Subscriptions) MessageType() string { return m.Type }
+func (m *Heartbeat) MessageType() string     { return m.Type }
+func (m *Ticker) MessageType() string        { return m.Type }
+func (m *Level2) MessageType() string        { return m.Type }
+func (m *Error) MessageType() string         { return m.Type }
+func (m *Order) MessageType() string         { return m.Type }
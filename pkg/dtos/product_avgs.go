@@ -1,10 +1,64 @@
 package dtos
 
 import (
-	"math/big"
+	"time"
 )
 
-//ProductAvgs defines the data struct that containts all the data points according to the sliding window
+//ProductAvgs defines the data struct that containts all the data points according to the sliding window.
+//Emissions are immutable value snapshots, they share no state with the calculator.
 type ProductAvgs struct {
-	Products map[string]*big.Float
+	// Delta is set when only the products whose vwap changed since the last emission are present
+	Delta    bool               `json:"delta,omitempty"`
+	Products map[string]Decimal `json:"products"`
+	// LastPrices holds the price of the last trade of every product
+	LastPrices map[string]Decimal `json:"last_prices,omitempty"`
+	// Quotes holds the best bid and ask of every product subscribed to the ticker
+	Quotes map[string]Quote `json:"quotes,omitempty"`
+	// Books holds the top of the order book of every product subscribed to level2
+	Books map[string]Book `json:"books,omitempty"`
+	// OwnFills holds the vwap of our own fills of every product, on authenticated feeds
+	OwnFills map[string]OwnFills `json:"own_fills,omitempty"`
+	// Aggregates holds the value of every configured aggregator, keyed by product and aggregator name
+	Aggregates map[string]map[string]Decimal `json:"aggregates,omitempty"`
+	// Bands holds the standard deviation bands around the vwap of every product
+	Bands map[string][]Band `json:"bands,omitempty"`
+	// Windows holds the results of every configured window, keyed by product and window name
+	Windows map[string]map[string]WindowAvgs `json:"windows,omitempty"`
+	// Profiles holds the volume profile of the primary window of every product configured with one
+	Profiles map[string]VolumeProfile `json:"profiles,omitempty"`
+	// Triangles holds the deviation of every product from its synthetic cross rates
+	Triangles []Triangle `json:"triangles,omitempty"`
+	// SessionCloses holds the final vwap of the anchored sessions that just reset
+	SessionCloses []SessionClose `json:"session_closes,omitempty"`
+}
+
+//WindowAvgs defines the results of a single sliding window of a product
+type WindowAvgs struct {
+	Vwap       Decimal            `json:"vwap"`
+	Aggregates map[string]Decimal `json:"aggregates,omitempty"`
+	Bands      []Band             `json:"bands,omitempty"`
+}
+
+//Band defines the vwap ± K·σ band, σ being the volume weighted standard deviation
+type Band struct {
+	K     float64 `json:"k"`
+	Upper Decimal `json:"upper"`
+	Lower Decimal `json:"lower"`
+}
+
+//OwnFills defines the vwap of our own fills of a product and how it deviates from the market vwap
+type OwnFills struct {
+	Vwap Decimal `json:"vwap"`
+	// Fills is how many of our fills the primary window holds
+	Fills int `json:"fills"`
+	// Deviation is (own vwap - market vwap) / market vwap
+	Deviation Decimal `json:"deviation"`
+}
+
+//SessionClose defines the final record of an anchored vwap session
+type SessionClose struct {
+	ProductId string    `json:"product_id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Vwap      Decimal   `json:"vwap"`
 }
@@ -5,4 +5,12 @@ type Subscription struct {
 	Type       string   `json:"type"`
 	ProductIds []string `json:"product_ids"`
 	Channels   []string `json:"channels"`
+	// Signature, Key, Passphrase and Timestamp authenticate the subscription, e.g. for the user channel
+	Signature  string `json:"signature,omitempty"`
+	Key        string `json:"key,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+	// Sign, when set, signs the subscription right before it's sent, reconnections included since
+	// signatures expire
+	Sign func(*Subscription) error `json:"-"`
 }
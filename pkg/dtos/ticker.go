@@ -0,0 +1,32 @@
+package dtos
+
+import (
+	"math/big"
+	"time"
+)
+
+//Ticker defines the message of the Coinbase ticker channel, the last trade along with the best bid and ask
+type Ticker struct {
+	Type      string     `json:"type"`
+	Sequence  int64      `json:"sequence"`
+	ProductId string     `json:"product_id"`
+	Price     *big.Float `json:"price"`
+	Open24h   *big.Float `json:"open_24h"`
+	Volume24h *big.Float `json:"volume_24h"`
+	Low24h    *big.Float `json:"low_24h"`
+	High24h   *big.Float `json:"high_24h"`
+	BestBid   *big.Float `json:"best_bid"`
+	BestAsk   *big.Float `json:"best_ask"`
+	Side      string     `json:"side"`
+	Time      time.Time  `json:"time"`
+	TradeId   int64      `json:"trade_id"`
+	LastSize  *big.Float `json:"last_size"`
+}
+
+//Quote defines the best bid and ask of a product along with its 24h volume, as last reported by the ticker
+type Quote struct {
+	BestBid   Decimal `json:"best_bid"`
+	BestAsk   Decimal `json:"best_ask"`
+	Spread    Decimal `json:"spread"`
+	Volume24h Decimal `json:"volume_24h"`
+}
@@ -0,0 +1,12 @@
+package dtos
+
+//Triangle defines the deviation of the vwap of a product from the synthetic cross rate
+//derived through the Via currency, e.g. ETH-BTC against ETH-USD / BTC-USD via USD
+type Triangle struct {
+	ProductId string  `json:"product_id"`
+	Via       string  `json:"via"`
+	Direct    Decimal `json:"direct"`
+	Synthetic Decimal `json:"synthetic"`
+	// BasisBps is (Direct - Synthetic) / Synthetic in basis points
+	BasisBps Decimal `json:"basis_bps"`
+}
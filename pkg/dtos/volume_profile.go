@@ -0,0 +1,17 @@
+package dtos
+
+//VolumeProfile defines the volume at price histogram of the window of a product.
+//Prices are the lower bound of their bucket, the value area spans [ValueAreaLow, ValueAreaHigh).
+type VolumeProfile struct {
+	BucketWidth    Decimal      `json:"bucket_width"`
+	Levels         []PriceLevel `json:"levels"`
+	PointOfControl Decimal      `json:"point_of_control"`
+	ValueAreaLow   Decimal      `json:"value_area_low"`
+	ValueAreaHigh  Decimal      `json:"value_area_high"`
+}
+
+//PriceLevel defines the volume traded within a price bucket
+type PriceLevel struct {
+	Price  Decimal `json:"price"`
+	Volume Decimal `json:"volume"`
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	messages := r.NewCounterVec("test_messages_total", "Messages by type.", "type")
+	messages.WithLabelValues("match").Inc()
+	messages.WithLabelValues("match").Add(2)
+	messages.WithLabelValues(`quote"d`).Inc()
+	// negative deltas would break the counter semantics
+	messages.WithLabelValues("match").Add(-1)
+	lag := r.NewGauge("test_lag_seconds", "Lag\\nof the feed.")
+	lag.Set(1.5)
+	lag.Inc()
+	// registering a name again returns the existing family
+	r.NewCounterVec("test_messages_total", "Messages by type.", "type").WithLabelValues("match").Inc()
+
+	assert.Equal(t, 4.0, messages.WithLabelValues("match").Value())
+	assert.Equal(t, 2.5, lag.Value())
+
+	want := strings.Join([]string{
+		"# HELP test_lag_seconds Lag\\\\nof the feed.",
+		"# TYPE test_lag_seconds gauge",
+		"test_lag_seconds 2.5",
+		"# HELP test_messages_total Messages by type.",
+		"# TYPE test_messages_total counter",
+		`test_messages_total{type="match"} 4`,
+		`test_messages_total{type="quote\"d"} 1`,
+		"",
+	}, "\n")
+	buf := &bytes.Buffer{}
+	assert.NoError(t, r.Write(buf))
+	assert.Equal(t, want, buf.String())
+
+	recorder := httptest.NewRecorder()
+	r.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+	assert.Equal(t, want, string(body))
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "version=0.0.4")
+
+	assert.Panics(t, func() { messages.WithLabelValues() })
+}
@@ -15,11 +15,11 @@ type VWAPCalculator struct {
 }
 
 // CalcAvg provides a mock function with given fields: ctx, responseChan
-func (_m *VWAPCalculator) CalcAvg(ctx context.Context, responseChan <-chan *dtos.Response) (<-chan *dtos.ProductAvgs, error) {
+func (_m *VWAPCalculator) CalcAvg(ctx context.Context, responseChan <-chan dtos.Message) (<-chan *dtos.ProductAvgs, error) {
 	ret := _m.Called(ctx, responseChan)
 
 	var r0 <-chan *dtos.ProductAvgs
-	if rf, ok := ret.Get(0).(func(context.Context, <-chan *dtos.Response) <-chan *dtos.ProductAvgs); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, <-chan dtos.Message) <-chan *dtos.ProductAvgs); ok {
 		r0 = rf(ctx, responseChan)
 	} else {
 		if ret.Get(0) != nil {
@@ -28,7 +28,7 @@ func (_m *VWAPCalculator) CalcAvg(ctx context.Context, responseChan <-chan *dtos
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, <-chan *dtos.Response) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, <-chan dtos.Message) error); ok {
 		r1 = rf(ctx, responseChan)
 	} else {
 		r1 = ret.Error(1)
@@ -4,6 +4,7 @@ package mocks
 
 import (
 	context "context"
+	pkg "vwap/pkg"
 	dtos "vwap/pkg/dtos"
 
 	mock "github.com/stretchr/testify/mock"
@@ -19,13 +20,13 @@ func (_m *Websocket) Close() {
 	_m.Called()
 }
 
-// Connect provides a mock function with given fields: url
-func (_m *Websocket) Connect(url string) error {
-	ret := _m.Called(url)
+// Connect provides a mock function with given fields: endpoint
+func (_m *Websocket) Connect(endpoint pkg.Endpoint) error {
+	ret := _m.Called(endpoint)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string) error); ok {
-		r0 = rf(url)
+	if rf, ok := ret.Get(0).(func(pkg.Endpoint) error); ok {
+		r0 = rf(endpoint)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -34,15 +35,15 @@ func (_m *Websocket) Connect(url string) error {
 }
 
 // Subscribe provides a mock function with given fields: ctx, request
-func (_m *Websocket) Subscribe(ctx context.Context, request *dtos.Subscription) (<-chan *dtos.Response, error) {
+func (_m *Websocket) Subscribe(ctx context.Context, request *dtos.Subscription) (<-chan dtos.Message, error) {
 	ret := _m.Called(ctx, request)
 
-	var r0 <-chan *dtos.Response
-	if rf, ok := ret.Get(0).(func(context.Context, *dtos.Subscription) <-chan *dtos.Response); ok {
+	var r0 <-chan dtos.Message
+	if rf, ok := ret.Get(0).(func(context.Context, *dtos.Subscription) <-chan dtos.Message); ok {
 		r0 = rf(ctx, request)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(<-chan *dtos.Response)
+			r0 = ret.Get(0).(<-chan dtos.Message)
 		}
 	}
 
@@ -0,0 +1,11 @@
+package pkg
+
+import (
+	"context"
+	"vwap/pkg/dtos"
+)
+
+//Notifier defines the interface for delivering the alerts raised by the rules engine
+type Notifier interface {
+	Notify(ctx context.Context, alert *dtos.Alert) error
+}
@@ -0,0 +1,108 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"vwap/pkg"
+	"vwap/pkg/dtos"
+)
+
+var (
+	_ pkg.Notifier = &WriterNotifier{}
+	_ pkg.Notifier = &WebhookNotifier{}
+)
+
+const (
+	stdoutType  = "stdout"
+	fileType    = "file"
+	webhookType = "webhook"
+	// webhookTimeout bounds every webhook call, a hanging endpoint would otherwise hold the alerts back
+	webhookTimeout = 10 * time.Second
+)
+
+// WriterNotifier writes every alert as a json line, to stdout or to a file
+type WriterNotifier struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func (w *WriterNotifier) Notify(ctx context.Context, alert *dtos.Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.writer.Write(append(payload, '\n'))
+	return err
+}
+
+func NewWriterNotifier(writer io.Writer) *WriterNotifier {
+	return &WriterNotifier{
+		writer: writer,
+	}
+}
+
+// NewFileNotifier appends the alerts to the file at path
+func NewFileNotifier(path string) (*WriterNotifier, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterNotifier(file), nil
+}
+
+// WebhookNotifier posts every alert as json to the url
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, alert *dtos.Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", response.Status)
+	}
+	return nil
+}
+
+func NewWebhookNotifier(url string, client *http.Client) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: client,
+	}
+}
+
+// NewNotifier creates the notifier of the given type, target being the webhook url or the file path
+func NewNotifier(notifierType, target string) (pkg.Notifier, error) {
+	switch notifierType {
+	case stdoutType, "":
+		return NewWriterNotifier(os.Stdout), nil
+	case fileType:
+		return NewFileNotifier(target)
+	case webhookType:
+		return NewWebhookNotifier(target, &http.Client{Timeout: webhookTimeout}), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", notifierType)
+	}
+}
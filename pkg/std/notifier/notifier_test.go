@@ -0,0 +1,103 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifiers(t *testing.T) {
+	const (
+		writer = iota
+		file
+		webhook
+		webhookError
+		unknownType
+	)
+	alert := &dtos.Alert{
+		Rule:      "btc 60k",
+		ProductId: "BTC-USD",
+		Message:   "vwap crossed above 60000",
+		Value:     "60500",
+	}
+	tests := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "test writer notifier",
+			testType: writer,
+		},
+		{
+			name:     "test file notifier",
+			testType: file,
+		},
+		{
+			name:     "test webhook notifier",
+			testType: webhook,
+		},
+		{
+			name:     "test webhook notifier error status",
+			testType: webhookError,
+		},
+		{
+			name:     "test unknown notifier type",
+			testType: unknownType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			switch tt.testType {
+			case writer:
+				buf := &bytes.Buffer{}
+				err := NewWriterNotifier(buf).Notify(ctx, alert)
+				assert.NoError(t, err)
+				received := &dtos.Alert{}
+				assert.NoError(t, json.Unmarshal(buf.Bytes(), received))
+				assert.Equal(t, alert.Rule, received.Rule)
+			case file:
+				path := filepath.Join(t.TempDir(), "alerts.log")
+				n, err := NewNotifier(fileType, path)
+				assert.NoError(t, err)
+				assert.NoError(t, n.Notify(ctx, alert))
+				assert.NoError(t, n.Notify(ctx, alert))
+				payload, err := os.ReadFile(path)
+				assert.NoError(t, err)
+				assert.Equal(t, 2, bytes.Count(payload, []byte("\n")))
+			case webhook:
+				received := make(chan *dtos.Alert, 1)
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					a := &dtos.Alert{}
+					assert.NoError(t, json.NewDecoder(r.Body).Decode(a))
+					received <- a
+				}))
+				defer server.Close()
+				n, err := NewNotifier(webhookType, server.URL)
+				assert.NoError(t, err)
+				assert.Equal(t, webhookTimeout, n.(*WebhookNotifier).client.Timeout)
+				assert.NoError(t, n.Notify(ctx, alert))
+				assert.Equal(t, alert.Message, (<-received).Message)
+			case webhookError:
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				}))
+				defer server.Close()
+				err := NewWebhookNotifier(server.URL, server.Client()).Notify(ctx, alert)
+				assert.Error(t, err)
+			case unknownType:
+				n, err := NewNotifier("email", "")
+				assert.Nil(t, n)
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"vwap/pkg/dtos"
+)
+
+// errUnknownType is returned for messages whose type has no struct to decode into
+var errUnknownType = errors.New("unknown message type")
+
+// messageTypes creates the struct every message type is decoded into, keyed by type
+var messageTypes = map[string]func() dtos.Message{
+	"match":         func() dtos.Message { return &dtos.Match{} },
+	"last_match":    func() dtos.Message { return &dtos.LastMatch{} },
+	"subscriptions": func() dtos.Message { return &dtos.Subscriptions{} },
+	"heartbeat":     func() dtos.Message { return &dtos.Heartbeat{} },
+	"ticker":        func() dtos.Message { return &dtos.Ticker{} },
+	"snapshot":      func() dtos.Message { return &dtos.Level2{} },
+	"l2update":      func() dtos.Message { return &dtos.Level2{} },
+	"error":         func() dtos.Message { return &dtos.Error{} },
+	// the lifecycle of our own orders on the user channel
+	"received": func() dtos.Message { return &dtos.Order{} },
+	"open":     func() dtos.Message { return &dtos.Order{} },
+	"done":     func() dtos.Message { return &dtos.Order{} },
+	"change":   func() dtos.Message { return &dtos.Order{} },
+	"activate": func() dtos.Message { return &dtos.Order{} },
+}
+
+// decode reads the type of the message first, then decodes it into the struct of that type.
+// Unknown types are reported with errUnknownType rather than decoded into a zero valued struct.
+func decode(msg []byte) (dtos.Message, error) {
+	envelope := struct {
+		Type string `json:"type"`
+	}{}
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		return nil, err
+	}
+	newMessage, ok := messageTypes[envelope.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownType, envelope.Type)
+	}
+	message := newMessage()
+	if err := json.Unmarshal(msg, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"testing"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		want    func(t *testing.T, msg dtos.Message)
+		wantErr error
+	}{
+		{
+			name: "test match",
+			msg:  `{"type":"match","trade_id":10,"product_id":"BTC-USD","size":"0.5","price":"100.1","side":"buy"}`,
+			want: func(t *testing.T, msg dtos.Message) {
+				match, ok := msg.(*dtos.Match)
+				assert.True(t, ok)
+				assert.Equal(t, int64(10), match.TradeId)
+				assert.Equal(t, "100.1", match.Price.Text('f', -1))
+			},
+		},
+		{
+			name: "test last match",
+			msg:  `{"type":"last_match","trade_id":9,"product_id":"BTC-USD","size":"1","price":"100"}`,
+			want: func(t *testing.T, msg dtos.Message) {
+				lastMatch, ok := msg.(*dtos.LastMatch)
+				assert.True(t, ok)
+				assert.Equal(t, "last_match", lastMatch.MessageType())
+				assert.Equal(t, int64(9), lastMatch.TradeId)
+			},
+		},
+		{
+			name: "test subscriptions",
+			msg:  `{"type":"subscriptions","channels":[{"name":"matches","product_ids":["BTC-USD"]}]}`,
+			want: func(t *testing.T, msg dtos.Message) {
+				subscriptions, ok := msg.(*dtos.Subscriptions)
+				assert.True(t, ok)
+				assert.Equal(t, []dtos.SubscriptionChannel{{Name: "matches", ProductIds: []string{"BTC-USD"}}},
+					subscriptions.Channels)
+			},
+		},
+		{
+			name: "test heartbeat",
+			msg:  `{"type":"heartbeat","sequence":90,"last_trade_id":20,"product_id":"BTC-USD"}`,
+			want: func(t *testing.T, msg dtos.Message) {
+				heartbeat, ok := msg.(*dtos.Heartbeat)
+				assert.True(t, ok)
+				assert.Equal(t, int64(90), heartbeat.Sequence)
+				assert.Equal(t, int64(20), heartbeat.LastTradeId)
+			},
+		},
+		{
+			name: "test ticker",
+			msg: `{"type":"ticker","sequence":5,"product_id":"BTC-USD","price":"100","best_bid":"99.5",` +
+				`"best_ask":"100.5","volume_24h":"1000","time":"2021-01-01T00:00:00Z"}`,
+			want: func(t *testing.T, msg dtos.Message) {
+				ticker, ok := msg.(*dtos.Ticker)
+				assert.True(t, ok)
+				assert.Equal(t, int64(5), ticker.Sequence)
+				assert.Equal(t, "99.5", ticker.BestBid.Text('f', -1))
+				assert.Equal(t, "100.5", ticker.BestAsk.Text('f', -1))
+				assert.Equal(t, "1000", ticker.Volume24h.Text('f', -1))
+			},
+		},
+		{
+			name: "test level2 snapshot",
+			msg:  `{"type":"snapshot","product_id":"BTC-USD","bids":[["99.5","1.2"]],"asks":[["100.5","0.3"]]}`,
+			want: func(t *testing.T, msg dtos.Message) {
+				level2, ok := msg.(*dtos.Level2)
+				assert.True(t, ok)
+				assert.Equal(t, "snapshot", level2.Type)
+				assert.Equal(t, [][2]string{{"99.5", "1.2"}}, level2.Bids)
+				assert.Equal(t, [][2]string{{"100.5", "0.3"}}, level2.Asks)
+			},
+		},
+		{
+			name: "test level2 update",
+			msg:  `{"type":"l2update","product_id":"BTC-USD","changes":[["buy","99.6","0.1"]]}`,
+			want: func(t *testing.T, msg dtos.Message) {
+				level2, ok := msg.(*dtos.Level2)
+				assert.True(t, ok)
+				assert.Equal(t, "l2update", level2.Type)
+				assert.Equal(t, [][3]string{{"buy", "99.6", "0.1"}}, level2.Changes)
+			},
+		},
+		{
+			name: "test error",
+			msg:  `{"type":"error","message":"Failed to subscribe","reason":"BTC-XYZ is not a valid product"}`,
+			want: func(t *testing.T, msg dtos.Message) {
+				assert.Equal(t, &dtos.Error{
+					Type:    "error",
+					Message: "Failed to subscribe",
+					Reason:  "BTC-XYZ is not a valid product",
+				}, msg)
+			},
+		},
+		{
+			name:    "test unknown type",
+			msg:     `{"type":"status","products":[]}`,
+			wantErr: errUnknownType,
+		},
+		{
+			name:    "test invalid json",
+			msg:     `{"type":`,
+			wantErr: assert.AnError,
+		},
+		{
+			name:    "test invalid ticker",
+			msg:     `{"type":"ticker","best_bid":"not a number"}`,
+			wantErr: assert.AnError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := decode([]byte(tt.msg))
+			switch tt.wantErr {
+			case nil:
+				assert.NoError(t, err)
+				tt.want(t, msg)
+			case assert.AnError:
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, errUnknownType)
+			default:
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// pingCodec sends empty ping frames, the peer answers them with pongs the client discards
+var pingCodec = websocket.Codec{
+	Marshal: func(interface{}) ([]byte, byte, error) {
+		return nil, websocket.PingFrame, nil
+	},
+}
+
+// keepaliveConn bounds every read and write of the connection once the handshake is done, so a
+// half-open connection fails instead of hanging. Any frame, pongs included, extends the read deadline.
+type keepaliveConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	closed       chan struct{}
+	closeOnce    sync.Once
+}
+
+func newKeepaliveConn(conn net.Conn) *keepaliveConn {
+	return &keepaliveConn{Conn: conn, closed: make(chan struct{})}
+}
+
+// start applies the timeouts, it must be called before the connection is shared
+func (c *keepaliveConn) start(readTimeout, writeTimeout time.Duration) {
+	c.readTimeout = readTimeout
+	c.writeTimeout = writeTimeout
+}
+
+func (c *keepaliveConn) Read(b []byte) (int, error) {
+	if c.readTimeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	n, err := c.Conn.Read(b)
+	if c.readTimeout > 0 && isTimeout(err) {
+		readTimeouts.Inc()
+	}
+	return n, err
+}
+
+func (c *keepaliveConn) Write(b []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	n, err := c.Conn.Write(b)
+	if c.writeTimeout > 0 && isTimeout(err) {
+		writeTimeouts.Inc()
+		// a frame may be half written, closing makes the reader fail and reconnect
+		c.Close()
+	}
+	return n, err
+}
+
+func (c *keepaliveConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// ping sends a ping every interval until the connection is closed. A failed ping closes the
+// connection, so the reader reconnects.
+func ping(ws *websocket.Conn, conn *keepaliveConn, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-conn.closed:
+			return
+		case <-ticker.C:
+			if err := pingCodec.Send(ws, nil); err != nil {
+				select {
+				case <-conn.closed:
+				default:
+					log.Printf("unable to ping the feed: %v", err)
+					conn.Close()
+				}
+				return
+			}
+			pings.Inc()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"vwap/pkg"
+	"vwap/pkg/dtos"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+// silentServer keeps connections open without ever sending a message. Reading them answers the
+// pings, unless the server is deaf.
+func silentServer(deaf bool) *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		if deaf {
+			// never reads, so pings go unanswered until the client drops the connection
+			time.Sleep(time.Second)
+			return
+		}
+		io.Copy(ioutil.Discard, ws)
+	}))
+}
+
+func TestStdWebsocket_Keepalive(t *testing.T) {
+	tests := []struct {
+		name         string
+		deaf         bool
+		pingInterval time.Duration
+		wantDropped  bool
+	}{
+		{
+			name:        "test read timeout drops a silent connection",
+			wantDropped: true,
+		},
+		{
+			name:         "test pongs keep a quiet connection alive",
+			pingInterval: 20 * time.Millisecond,
+		},
+		{
+			name:         "test unanswered pings drop the connection",
+			deaf:         true,
+			pingInterval: 20 * time.Millisecond,
+			wantDropped:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := silentServer(tt.deaf)
+			defer server.Close()
+			s := NewStdWebsocket()
+			s.minBackoff = time.Millisecond
+			u := "ws" + strings.TrimPrefix(server.URL, "http")
+			assert.NoError(t, s.Connect(pkg.Endpoint{
+				URL:          u,
+				PingInterval: tt.pingInterval,
+				ReadTimeout:  100 * time.Millisecond,
+				WriteTimeout: time.Second,
+			}))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			readTimeoutsBefore, pingsBefore := readTimeouts.Value(), pings.Value()
+			response, err := s.Subscribe(ctx, &dtos.Subscription{
+				Type:       "subscribe",
+				ProductIds: []string{"BTC-USD"},
+				Channels:   []string{"matches"},
+			})
+			assert.NoError(t, err)
+			select {
+			case msg := <-response:
+				assert.True(t, tt.wantDropped, "unexpected message %v", msg)
+				assert.Equal(t, connectionErr, msg.(*dtos.Error).Type)
+				assert.Greater(t, readTimeouts.Value(), readTimeoutsBefore)
+			case <-time.After(400 * time.Millisecond):
+				assert.False(t, tt.wantDropped, "the connection was never dropped")
+				assert.Equal(t, readTimeoutsBefore, readTimeouts.Value())
+			}
+			if tt.pingInterval > 0 {
+				assert.Greater(t, pings.Value(), pingsBefore)
+			}
+		})
+	}
+}
+
+func TestKeepaliveConn_WriteTimeout(t *testing.T) {
+	// nothing reads the other end of the pipe, so every write blocks
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := newKeepaliveConn(client)
+	conn.start(0, 20*time.Millisecond)
+	writeTimeoutsBefore := writeTimeouts.Value()
+	_, err := conn.Write([]byte("ping"))
+	assert.True(t, isTimeout(err))
+	assert.Greater(t, writeTimeouts.Value(), writeTimeoutsBefore)
+	select {
+	case <-conn.closed:
+	default:
+		assert.Fail(t, "the connection was not closed")
+	}
+}
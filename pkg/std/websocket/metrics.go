@@ -0,0 +1,20 @@
+package websocket
+
+import "vwap/pkg/metrics"
+
+var (
+	messagesReceived = metrics.NewCounterVec("vwap_websocket_messages_total",
+		"Messages received from the feed by type.", "type")
+	decodeErrors = metrics.NewCounter("vwap_websocket_decode_errors_total",
+		"Messages received from the feed that could not be decoded.")
+	unknownMessages = metrics.NewCounter("vwap_websocket_unknown_messages_total",
+		"Messages received from the feed with a type no struct is decoded into.")
+	reconnects = metrics.NewCounter("vwap_websocket_reconnects_total",
+		"Reconnections to the feed after the connection was lost.")
+	pings = metrics.NewCounter("vwap_websocket_pings_total",
+		"Pings sent to keep the connection to the feed alive.")
+	readTimeouts = metrics.NewCounter("vwap_websocket_read_timeouts_total",
+		"Connections dropped after no frame, pongs included, arrived within the read timeout.")
+	writeTimeouts = metrics.NewCounter("vwap_websocket_write_timeouts_total",
+		"Connections dropped after a write, pings included, exceeded the write timeout.")
+)
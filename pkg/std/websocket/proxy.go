@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// proxyFor returns the proxy to reach the target through, nil to connect directly. The explicit proxy
+// takes precedence over the HTTPS_PROXY, HTTP_PROXY and ALL_PROXY variables, which honor NO_PROXY.
+func proxyFor(explicit string, target *url.URL) (*url.URL, error) {
+	if explicit != "" {
+		return url.Parse(explicit)
+	}
+	config := httpproxy.FromEnvironment()
+	allProxy := getenv("ALL_PROXY", "all_proxy")
+	if config.HTTPSProxy == "" {
+		config.HTTPSProxy = allProxy
+	}
+	if config.HTTPProxy == "" {
+		config.HTTPProxy = allProxy
+	}
+	// the proxy variables are keyed by the scheme the websocket upgrades from
+	request := *target
+	request.Scheme = "http"
+	if target.Scheme == "wss" {
+		request.Scheme = "https"
+	}
+	return config.ProxyFunc()(&request)
+}
+
+func getenv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// dialProxy connects to addr through the proxy, either an HTTP CONNECT or a SOCKS5 one
+func dialProxy(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	switch proxyURL.Scheme {
+	case "http", "https":
+		return dialConnect(ctx, dialer, proxyURL, addr)
+	case "socks5", "socks5h":
+		socks, err := proxy.FromURL(proxyURL, dialer)
+		if err != nil {
+			return nil, err
+		}
+		return socks.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+}
+
+// dialConnect opens a tunnel to addr with an HTTP CONNECT request, authenticated when the proxy url
+// holds a user
+func dialConnect(ctx context.Context, dialer *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := request.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// the server speaks first neither on tls nor on websocket handshakes, so nothing past the
+	// response is buffered
+	response, err := http.ReadResponse(bufio.NewReader(conn), request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused the tunnel to %s: %s", addr, response.Status)
+	}
+	return conn, nil
+}
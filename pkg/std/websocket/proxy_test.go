@@ -0,0 +1,252 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"vwap/pkg"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+// testProxy stands for a proxy, it forwards every tunnel to the target whatever address was
+// requested, so the feed can be reached through hosts that don't resolve
+type testProxy struct {
+	listener  net.Listener
+	target    string
+	requested chan string
+}
+
+func newTestProxy(t *testing.T, target string, serve func(p *testProxy, conn net.Conn)) *testProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	p := &testProxy{listener: listener, target: target, requested: make(chan string, 8)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(p, conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return p
+}
+
+// tunnel pipes the client connection to the target until either side is done
+func (p *testProxy) tunnel(client net.Conn, requested string) {
+	p.requested <- requested
+	server, err := net.Dial("tcp", p.target)
+	if err != nil {
+		client.Close()
+		return
+	}
+	go func() {
+		io.Copy(server, client)
+		server.Close()
+	}()
+	io.Copy(client, server)
+	client.Close()
+}
+
+// serveConnect answers HTTP CONNECT requests, requiring the user:pass credentials
+func serveConnect(p *testProxy, conn net.Conn) {
+	request, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || request.Method != http.MethodConnect {
+		conn.Close()
+		return
+	}
+	if username, password, ok := parseProxyAuth(request); ok && (username != "user" || password != "pass") {
+		io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		conn.Close()
+		return
+	}
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	p.tunnel(conn, request.Host)
+}
+
+func parseProxyAuth(request *http.Request) (string, string, bool) {
+	header := request.Header.Get("Proxy-Authorization")
+	if header == "" {
+		return "", "", false
+	}
+	// reuses the parsing of the basic authorization
+	r := &http.Request{Header: http.Header{"Authorization": {header}}}
+	username, password, _ := r.BasicAuth()
+	return username, password, true
+}
+
+// serveSocks answers SOCKS5 connect requests without authentication
+func serveSocks(p *testProxy, conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(reader, greeting); err != nil {
+		conn.Close()
+		return
+	}
+	if _, err := io.ReadFull(reader, make([]byte, greeting[1])); err != nil {
+		conn.Close()
+		return
+	}
+	conn.Write([]byte{5, 0})
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		conn.Close()
+		return
+	}
+	var host string
+	switch header[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(reader, ip)
+		host = net.IP(ip).String()
+	case 3:
+		length, _ := reader.ReadByte()
+		name := make([]byte, length)
+		io.ReadFull(reader, name)
+		host = string(name)
+	default:
+		conn.Close()
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(reader, port); err != nil {
+		conn.Close()
+		return
+	}
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	p.tunnel(conn, net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+}
+
+// clearProxyEnv unsets the proxy variables of the environment for the test
+func clearProxyEnv(t *testing.T) {
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "NO_PROXY"} {
+		t.Setenv(name, "")
+		t.Setenv(strings.ToLower(name), "")
+	}
+}
+
+func TestStdWebsocket_Proxy(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(connectTest))
+	defer server.Close()
+	target := strings.TrimPrefix(server.URL, "http://")
+	connect := newTestProxy(t, target, serveConnect)
+	socks := newTestProxy(t, target, serveSocks)
+	connectURL := "http://" + connect.listener.Addr().String()
+	socksURL := "socks5://" + socks.listener.Addr().String()
+
+	tests := []struct {
+		name string
+		url  string
+		// proxy is the explicit proxy of the endpoint
+		proxy string
+		env   map[string]string
+		// via is the proxy expected to carry the connection, nil when it's direct
+		via           *testProxy
+		wantRequested string
+		wantErr       bool
+	}{
+		{
+			name:          "test explicit http connect proxy",
+			url:           "ws://feed.example/",
+			proxy:         connectURL,
+			via:           connect,
+			wantRequested: "feed.example:80",
+		},
+		{
+			name:          "test explicit proxy with credentials",
+			url:           "ws://feed.example:8080/",
+			proxy:         "http://user:pass@" + connect.listener.Addr().String(),
+			via:           connect,
+			wantRequested: "feed.example:8080",
+		},
+		{
+			name:    "test proxy refusing the credentials",
+			url:     "ws://feed.example/",
+			proxy:   "http://user:wrong@" + connect.listener.Addr().String(),
+			wantErr: true,
+		},
+		{
+			name:          "test explicit socks5 proxy",
+			url:           "ws://feed.example/",
+			proxy:         socksURL,
+			via:           socks,
+			wantRequested: "feed.example:80",
+		},
+		{
+			name:          "test explicit proxy wins over the environment",
+			url:           "ws://feed.example/",
+			proxy:         socksURL,
+			env:           map[string]string{"HTTP_PROXY": connectURL},
+			via:           socks,
+			wantRequested: "feed.example:80",
+		},
+		{
+			name:          "test http proxy of the environment",
+			url:           "ws://feed.example/",
+			env:           map[string]string{"HTTP_PROXY": connectURL},
+			via:           connect,
+			wantRequested: "feed.example:80",
+		},
+		{
+			name:          "test all proxy of the environment",
+			url:           "ws://feed.example/",
+			env:           map[string]string{"ALL_PROXY": socksURL},
+			via:           socks,
+			wantRequested: "feed.example:80",
+		},
+		{
+			name: "test https proxy of the environment skips ws urls",
+			url:  "ws://" + target + "/",
+			env:  map[string]string{"HTTPS_PROXY": connectURL},
+		},
+		{
+			name:    "test no proxy bypasses the environment",
+			url:     "ws://feed.example/",
+			env:     map[string]string{"HTTP_PROXY": connectURL, "NO_PROXY": "feed.example"},
+			wantErr: true,
+		},
+		{
+			name:    "test unsupported proxy scheme",
+			url:     "ws://feed.example/",
+			proxy:   "ftp://" + connect.listener.Addr().String(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearProxyEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			s := NewStdWebsocket()
+			err := s.Connect(pkg.Endpoint{URL: tt.url, Proxy: tt.proxy, DialTimeout: time.Second})
+			for _, p := range []*testProxy{connect, socks} {
+				var requested []string
+				for len(p.requested) > 0 {
+					requested = append(requested, <-p.requested)
+				}
+				if p == tt.via {
+					assert.Equal(t, []string{tt.wantRequested}, requested)
+				} else {
+					assert.Empty(t, requested)
+				}
+			}
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			s.ws.Close()
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package websocket
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSOptions defines the TLS configuration to load from PEM files
+type TLSOptions struct {
+	// CABundle holds the certificate authorities trusted instead of the system ones
+	CABundle string
+	// CertFile and KeyFile hold the client certificate and its key
+	CertFile string
+	KeyFile  string
+	// MinVersion is the minimum TLS version, e.g. tls.VersionTLS12, zero keeps the default one
+	MinVersion uint16
+}
+
+// LoadTLSConfig builds the TLS configuration of the options, the files left empty are not loaded
+func LoadTLSConfig(options TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: options.MinVersion}
+	if options.CABundle != "" {
+		data, err := ioutil.ReadFile(options.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", options.CABundle)
+		}
+		config.RootCAs = pool
+	}
+	if options.CertFile != "" || options.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
@@ -0,0 +1,83 @@
+package websocket
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"vwap/pkg"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestLoadTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(websocket.Handler(subscribeSuccessResponse))
+	defer server.Close()
+	dir := t.TempDir()
+	caBundle := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(caBundle,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	empty := filepath.Join(dir, "empty.pem")
+	assert.NoError(t, ioutil.WriteFile(empty, []byte("no certificate"), 0600))
+	u := "wss" + strings.TrimPrefix(server.URL, "https")
+
+	tests := []struct {
+		name           string
+		options        TLSOptions
+		wantLoadErr    bool
+		wantConnectErr bool
+	}{
+		{
+			name:    "test trusted ca bundle",
+			options: TLSOptions{CABundle: caBundle, MinVersion: tls.VersionTLS12},
+		},
+		{
+			name:           "test system authorities do not trust the server",
+			options:        TLSOptions{},
+			wantConnectErr: true,
+		},
+		{
+			name:    "test minimum version tls 1.3",
+			options: TLSOptions{CABundle: caBundle, MinVersion: tls.VersionTLS13},
+		},
+		{
+			name:        "test missing ca bundle",
+			options:     TLSOptions{CABundle: filepath.Join(dir, "missing.pem")},
+			wantLoadErr: true,
+		},
+		{
+			name:        "test ca bundle without certificates",
+			options:     TLSOptions{CABundle: empty},
+			wantLoadErr: true,
+		},
+		{
+			name:        "test client certificate without key",
+			options:     TLSOptions{CertFile: caBundle},
+			wantLoadErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := LoadTLSConfig(tt.options)
+			if tt.wantLoadErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.options.MinVersion, config.MinVersion)
+			s := NewStdWebsocket()
+			err = s.Connect(pkg.Endpoint{URL: u, TLSConfig: config, DialTimeout: time.Second})
+			if tt.wantConnectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			s.ws.Close()
+		})
+	}
+}
@@ -2,7 +2,12 @@ package websocket
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/url"
 	"time"
 	"vwap/pkg"
 	"vwap/pkg/dtos"
@@ -14,22 +19,165 @@ var _ pkg.Websocket = &StdWebsocket{}
 
 const (
 	unmarshalErr = "unmarshal_error"
+	// connectionErr reports a lost connection, the subscription is restored afterwards
+	connectionErr = "connection_error"
+	// defaultOrigin is sent on the handshake when the endpoint has no origin
+	defaultOrigin = "http://localhost/"
+	// minBackoff and maxBackoff bound the wait between reconnection attempts
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
 )
 
 type StdWebsocket struct {
-	ws   *websocket.Conn
-	exit chan struct{}
+	ws         *websocket.Conn
+	endpoint   pkg.Endpoint
+	exit       chan struct{}
+	minBackoff time.Duration
+	// reading tells whether the reader of a subscription owns the connection, closing it on exit
+	reading bool
 }
 
-func (s *StdWebsocket) Connect(url string) error {
-	origin := "http://localhost/"
-	ws, err := websocket.Dial(url, "", origin)
+func (s *StdWebsocket) Connect(endpoint pkg.Endpoint) error {
+	s.endpoint = endpoint
+	ws, err := s.dial()
 	s.ws = ws
 	return err
 }
 
-func (s *StdWebsocket) Subscribe(ctx context.Context, request *dtos.Subscription) (<-chan *dtos.Response, error) {
-	payload, err := json.Marshal(request)
+// dial connects to the endpoint, its dial timeout bounding the websocket handshake as well.
+// The keepalive of the endpoint applies from then on.
+func (s *StdWebsocket) dial() (*websocket.Conn, error) {
+	origin := s.endpoint.Origin
+	if origin == "" {
+		origin = defaultOrigin
+	}
+	config, err := websocket.NewConfig(s.endpoint.URL, origin)
+	if err != nil {
+		return nil, err
+	}
+	config.TlsConfig = s.endpoint.TLSConfig
+	conn, err := s.dialConn(config)
+	if err != nil {
+		return nil, &websocket.DialError{Config: config, Err: err}
+	}
+	keepalive := newKeepaliveConn(conn)
+	ws, err := websocket.NewClient(config, keepalive)
+	if err != nil {
+		conn.Close()
+		return nil, &websocket.DialError{Config: config, Err: err}
+	}
+	conn.SetDeadline(time.Time{})
+	keepalive.start(s.endpoint.ReadTimeout, s.endpoint.WriteTimeout)
+	if s.endpoint.PingInterval > 0 {
+		go ping(ws, keepalive, s.endpoint.PingInterval)
+	}
+	return ws, nil
+}
+
+// dialConn opens the connection the websocket handshake runs on, through the proxy when there is one.
+// The connection keeps the deadline of the dial timeout, it's up to the caller to clear it.
+func (s *StdWebsocket) dialConn(config *websocket.Config) (net.Conn, error) {
+	location := config.Location
+	if location.Scheme != "ws" && location.Scheme != "wss" {
+		return nil, websocket.ErrBadScheme
+	}
+	proxyURL, err := proxyFor(s.endpoint.Proxy, location)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if s.endpoint.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.endpoint.DialTimeout)
+		defer cancel()
+	}
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if proxyURL != nil {
+		conn, err = dialProxy(ctx, dialer, proxyURL, hostPort(location))
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", hostPort(location))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if location.Scheme == "wss" {
+		tlsConfig := &tls.Config{}
+		if config.TlsConfig != nil {
+			tlsConfig = config.TlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = location.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+// hostPort returns the address of the url, with the default port of its scheme when it has none
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "wss" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// marshalSubscription signs the subscription first when it's authenticated
+func marshalSubscription(request *dtos.Subscription) ([]byte, error) {
+	if request.Sign != nil {
+		if err := request.Sign(request); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(request)
+}
+
+// reconnect dials the feed again until it succeeds, then subscribes with the same request.
+// It returns false when the subscription is over before the connection could be restored.
+func (s *StdWebsocket) reconnect(ctx context.Context, request *dtos.Subscription) bool {
+	s.ws.Close()
+	backoff := s.minBackoff
+	for {
+		select {
+		case <-s.exit:
+			return false
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		ws, err := s.dial()
+		if err == nil {
+			var payload []byte
+			if payload, err = marshalSubscription(request); err == nil {
+				_, err = ws.Write(payload)
+			}
+			if err == nil {
+				s.ws = ws
+				reconnects.Inc()
+				return true
+			}
+			ws.Close()
+		}
+		log.Printf("unable to reconnect to %s: %v", s.endpoint.URL, err)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (s *StdWebsocket) Subscribe(ctx context.Context, request *dtos.Subscription) (<-chan dtos.Message, error) {
+	payload, err := marshalSubscription(request)
 	if err != nil {
 		return nil, err
 	}
@@ -38,12 +186,13 @@ func (s *StdWebsocket) Subscribe(ctx context.Context, request *dtos.Subscription
 		return nil, err
 	}
 	// let's be garbagged collected for the moment
-	responseChan := make(chan *dtos.Response)
+	responseChan := make(chan dtos.Message)
 	if _, err := s.ws.Write([]byte(payload)); err != nil {
 		return nil, err
 	}
+	s.reading = true
 	go func() {
-		defer s.ws.Close()
+		defer func() { s.ws.Close() }()
 		for {
 			select {
 			case <-s.exit:
@@ -51,20 +200,29 @@ func (s *StdWebsocket) Subscribe(ctx context.Context, request *dtos.Subscription
 			case <-ctx.Done():
 				return
 			default:
-				var msg = make([]byte, 2048)
-				var n int
-				if n, err = s.ws.Read(msg); err != nil {
-					s.dispatchError(responseChan, err.Error())
+				// receives whole messages, e.g. level2 snapshots are far bigger than any fixed buffer
+				var msg []byte
+				if err = websocket.Message.Receive(s.ws, &msg); err != nil {
+					if !s.dispatchError(ctx, responseChan, connectionErr, err.Error()) || !s.reconnect(ctx, request) {
+						return
+					}
 					continue
 				}
-				res := &dtos.Response{}
-				err := json.Unmarshal(msg[:n], res)
+				res, err := decode(msg)
+				if errors.Is(err, errUnknownType) {
+					unknownMessages.Inc()
+				}
 				if err != nil {
-					s.dispatchError(responseChan, err.Error())
+					decodeErrors.Inc()
+					if !s.dispatchError(ctx, responseChan, unmarshalErr, err.Error()) {
+						return
+					}
 					continue
 				}
-				responseChan <- res
-				time.Sleep(time.Millisecond * 10)
+				messagesReceived.WithLabelValues(res.MessageType()).Inc()
+				if !s.send(ctx, responseChan, res) {
+					return
+				}
 			}
 		}
 	}()
@@ -72,20 +230,39 @@ func (s *StdWebsocket) Subscribe(ctx context.Context, request *dtos.Subscription
 
 }
 
+// Close stops the subscription, or closes the connection when it has none, e.g. after it failed
 func (s *StdWebsocket) Close() {
+	if !s.reading {
+		if s.ws != nil {
+			s.ws.Close()
+		}
+		return
+	}
 	s.exit <- struct{}{}
 }
 
-func (s *StdWebsocket) dispatchError(responseChan chan *dtos.Response, msg string) {
-	responseChan <- &dtos.Response{
-		Type: unmarshalErr,
-		Error: dtos.Error{
-			Message: msg,
-		},
+func (s *StdWebsocket) dispatchError(ctx context.Context, responseChan chan dtos.Message, errType string, msg string) bool {
+	return s.send(ctx, responseChan, &dtos.Error{
+		Type:    errType,
+		Message: msg,
+	})
+}
+
+// send hands the message over to the subscriber, or gives up when the subscription is over,
+// as nobody may read the messages anymore, e.g. when the subscription of another connection failed
+func (s *StdWebsocket) send(ctx context.Context, responseChan chan dtos.Message, msg dtos.Message) bool {
+	select {
+	case responseChan <- msg:
+		return true
+	case <-s.exit:
+		return false
+	case <-ctx.Done():
+		return false
 	}
 }
 func NewStdWebsocket() *StdWebsocket {
 	return &StdWebsocket{
-		exit: make(chan struct{}),
+		exit:       make(chan struct{}),
+		minBackoff: minBackoff,
 	}
 }
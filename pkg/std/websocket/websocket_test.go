@@ -3,11 +3,17 @@ package websocket
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"math/big"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+	pkg "vwap/pkg"
 	"vwap/pkg/dtos"
 
 	"github.com/stretchr/testify/assert"
@@ -33,7 +39,7 @@ func subscribeSuccessResponse(ws *websocket.Conn) {
 	if n, err := ws.Read(msg); err != nil {
 		log.Print(msg[:n])
 	}
-	response, _ := json.Marshal(&dtos.Response{
+	response, _ := json.Marshal(&dtos.Match{
 		Type:      "match",
 		ProductId: "BTC-USD",
 		Price:     big.NewFloat(4.0),
@@ -49,6 +55,7 @@ func TestStdWebsocket_Websocket(t *testing.T) {
 		success = iota
 		subscriptionSuccess
 		subscriptionResponseError
+		reconnectAfterConnectionLost
 	)
 	tests := []struct {
 		name     string
@@ -66,6 +73,10 @@ func TestStdWebsocket_Websocket(t *testing.T) {
 			name:     "test subscription response error",
 			testType: subscriptionResponseError,
 		},
+		{
+			name:     "test reconnect after connection lost",
+			testType: reconnectAfterConnectionLost,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -75,14 +86,14 @@ func TestStdWebsocket_Websocket(t *testing.T) {
 				defer server.Close()
 				s := NewStdWebsocket()
 				u := "ws" + strings.TrimPrefix(server.URL, "http")
-				err := s.Connect(u)
+				err := s.Connect(pkg.Endpoint{URL: u})
 				assert.NoError(t, err)
 			case subscriptionSuccess:
 				server := httptest.NewServer(websocket.Handler(subscribeSuccessResponse))
 				defer server.Close()
 				s := NewStdWebsocket()
 				u := "ws" + strings.TrimPrefix(server.URL, "http")
-				err := s.Connect(u)
+				err := s.Connect(pkg.Endpoint{URL: u})
 				assert.NoError(t, err)
 				response, err := s.Subscribe(context.Background(), &dtos.Subscription{
 					Type:       "subscribe",
@@ -96,7 +107,7 @@ func TestStdWebsocket_Websocket(t *testing.T) {
 				defer server.Close()
 				s := NewStdWebsocket()
 				u := "ws" + strings.TrimPrefix(server.URL, "http")
-				err := s.Connect(u)
+				err := s.Connect(pkg.Endpoint{URL: u})
 				assert.NoError(t, err)
 				response, err := s.Subscribe(context.Background(), &dtos.Subscription{
 					Type:       "subscribe",
@@ -105,7 +116,149 @@ func TestStdWebsocket_Websocket(t *testing.T) {
 				})
 				assert.NotNil(t, response)
 				assert.NoError(t, err)
+			case reconnectAfterConnectionLost:
+				// the server closes every connection right after its first match
+				server := httptest.NewServer(websocket.Handler(subscribeSuccessResponse))
+				defer server.Close()
+				s := NewStdWebsocket()
+				s.minBackoff = time.Millisecond
+				u := "ws" + strings.TrimPrefix(server.URL, "http")
+				assert.NoError(t, s.Connect(pkg.Endpoint{URL: u}))
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				reconnectsBefore := reconnects.Value()
+				response, err := s.Subscribe(ctx, &dtos.Subscription{
+					Type:       "subscribe",
+					ProductIds: []string{"BTC-USD"},
+					Channels:   []string{"matches"},
+				})
+				assert.NoError(t, err)
+				var matches int
+				for matches < 2 {
+					if _, ok := (<-response).(*dtos.Match); ok {
+						matches++
+					}
+				}
+				assert.Greater(t, reconnects.Value(), reconnectsBefore)
 			}
 		})
 	}
 }
+
+func TestMarshalSubscription(t *testing.T) {
+	var signed int
+	request := &dtos.Subscription{
+		Type:       "subscribe",
+		ProductIds: []string{"BTC-USD"},
+		Channels:   []string{"user"},
+		Sign: func(s *dtos.Subscription) error {
+			signed++
+			s.Signature = fmt.Sprintf("signature-%d", signed)
+			return nil
+		},
+	}
+	// every marshal signs again, e.g. on reconnections
+	for _, want := range []string{"signature-1", "signature-2"} {
+		payload, err := marshalSubscription(request)
+		assert.NoError(t, err)
+		assert.Contains(t, string(payload), `"signature":"`+want+`"`)
+		assert.NotContains(t, string(payload), "Sign")
+	}
+	request.Sign = func(*dtos.Subscription) error { return errors.New("no clock") }
+	_, err := marshalSubscription(request)
+	assert.Error(t, err)
+}
+
+func TestStdWebsocket_Endpoint(t *testing.T) {
+	t.Run("test origin sent on the handshake", func(t *testing.T) {
+		origins := make(chan string, 1)
+		server := httptest.NewServer(websocket.Server{
+			Handshake: func(config *websocket.Config, r *http.Request) error {
+				origins <- r.Header.Get("Origin")
+				return nil
+			},
+			Handler: connectTest,
+		})
+		defer server.Close()
+		u := "ws" + strings.TrimPrefix(server.URL, "http")
+		s := NewStdWebsocket()
+		assert.NoError(t, s.Connect(pkg.Endpoint{URL: u, Origin: "https://vwap.example"}))
+		assert.Equal(t, "https://vwap.example", <-origins)
+		s.ws.Close()
+		assert.NoError(t, s.Connect(pkg.Endpoint{URL: u}))
+		assert.Equal(t, defaultOrigin, <-origins)
+		s.ws.Close()
+	})
+	t.Run("test dial timeout bounds the handshake", func(t *testing.T) {
+		// accepts the connection but never answers the handshake
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+		s := NewStdWebsocket()
+		start := time.Now()
+		err = s.Connect(pkg.Endpoint{URL: "ws://" + listener.Addr().String(), DialTimeout: 50 * time.Millisecond})
+		assert.Error(t, err)
+		assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	})
+	t.Run("test unsupported scheme", func(t *testing.T) {
+		s := NewStdWebsocket()
+		assert.Error(t, s.Connect(pkg.Endpoint{URL: "http://localhost/"}))
+	})
+}
+
+// acknowledgeSubscription answers right away like the feed does, then reports when the client closes the connection
+func acknowledgeSubscription(closed chan<- struct{}) websocket.Handler {
+	return func(ws *websocket.Conn) {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			return
+		}
+		if err := websocket.Message.Send(ws, `{"type":"subscriptions"}`); err != nil {
+			return
+		}
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+		closed <- struct{}{}
+	}
+}
+
+func TestStdWebsocket_CloseUnread(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	server := httptest.NewServer(acknowledgeSubscription(closed))
+	defer server.Close()
+	s := NewStdWebsocket()
+	u := "ws" + strings.TrimPrefix(server.URL, "http")
+	assert.NoError(t, s.Connect(pkg.Endpoint{URL: u}))
+	_, err := s.Subscribe(context.Background(), &dtos.Subscription{
+		Type:       "subscribe",
+		ProductIds: []string{"BTC-USD"},
+		Channels:   []string{"matches"},
+	})
+	assert.NoError(t, err)
+	// the acknowledgement is never read, the reader must still give up on close
+	time.Sleep(20 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("close blocked on the unread subscription")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection left open")
+	}
+}
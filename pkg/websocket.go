@@ -7,7 +7,7 @@ import (
 
 //Websocket defines the interface for the websocket client
 type Websocket interface {
-	Connect(url string) error
-	Subscribe(ctx context.Context, request *dtos.Subscription) (<-chan *dtos.Response, error)
+	Connect(endpoint Endpoint) error
+	Subscribe(ctx context.Context, request *dtos.Subscription) (<-chan dtos.Message, error)
 	Close()
 }
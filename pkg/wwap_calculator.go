@@ -7,6 +7,6 @@ import (
 
 //VWAPCalculator defines the interface for the vwap calculation
 type VWAPCalculator interface {
-	CalcAvg(ctx context.Context, responseChan <-chan *dtos.Response) (<-chan *dtos.ProductAvgs, error)
+	CalcAvg(ctx context.Context, responseChan <-chan dtos.Message) (<-chan *dtos.ProductAvgs, error)
 	Close()
 }